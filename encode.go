@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codegangsta/cli"
+
+	"github.com/dhogborg/go-pocsag/pocsag"
+)
+
+// encodeCommand generates a transmission with a single page, for testing of
+// receivers and of the decoder itself.
+var encodeCommand = cli.Command{
+	Name:  "encode",
+	Usage: "Generate a POCSAG transmission as a wav file or raw samples",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "capcode,c",
+			Value: 0,
+			Usage: "Capcode of the reciptient, 0-2097151",
+		},
+		cli.IntFlag{
+			Name:  "function",
+			Value: 0,
+			Usage: "Function bits, 0-3",
+		},
+		cli.StringFlag{
+			Name:  "message,m",
+			Value: "",
+			Usage: "Message text",
+		},
+		cli.StringFlag{
+			Name:  "type,t",
+			Value: "alpha",
+			Usage: "Message type: alpha, bcd, tone",
+		},
+		cli.StringFlag{
+			Name:  "charset",
+			Value: "default",
+			Usage: "Charset of alphanumeric messages, a name or a file with a custom map",
+		},
+		cli.IntFlag{
+			Name:  "baud,b",
+			Value: 1200,
+			Usage: "Baud 512/1200/2400",
+		},
+		cli.IntFlag{
+			Name:  "samplerate,s",
+			Value: 48000,
+			Usage: "Samplerate of the generated audio",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Value: "-",
+			Usage: "wav file to write, - for raw signed 16 bit samples to stdout",
+		},
+	},
+	Action: func(c *cli.Context) {
+
+		page := &pocsag.Page{
+			Capcode:  uint32(c.Int("capcode")),
+			Function: uint8(c.Int("function")),
+			Type:     pocsag.MessageType(c.String("type")),
+			Text:     c.String("message"),
+		}
+
+		if c.Int("function") < 0 || c.Int("function") > 3 {
+			println(fmt.Sprintf("invalid function: %d", c.Int("function")))
+			os.Exit(1)
+		}
+
+		if !knownBaud(c.Int("baud")) {
+			println(fmt.Sprintf("invalid baud: %d", c.Int("baud")))
+			os.Exit(1)
+		}
+
+		charset, err := pocsag.GetCharset(c.String("charset"))
+		if err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+
+		encoder := pocsag.NewEncoder(pocsag.Options{
+			Baud:       c.Int("baud"),
+			SampleRate: c.Int("samplerate"),
+			Charset:    charset,
+		})
+
+		output := c.String("output")
+
+		if output == "-" {
+			err = encoder.WriteRaw(os.Stdout, []*pocsag.Page{page})
+		} else {
+			var file *os.File
+			file, err = os.Create(output)
+			if err == nil {
+				err = encoder.WriteWav(file, []*pocsag.Page{page})
+				file.Close()
+			}
+		}
+
+		if err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
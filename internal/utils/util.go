@@ -2,46 +2,39 @@ package utils
 
 import (
 	"fmt"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
 
 	"github.com/dhogborg/go-pocsag/internal/datatypes"
 )
 
-var (
-	DEBUG bool
-	LEVEL int
-)
-
 var (
 	green = color.New(color.FgGreen)
 	red   = color.New(color.FgRed)
 	blue  = color.New(color.FgBlue)
 )
 
-// Tell the package to print debug data
-func SetDebug(d bool, verbosity int) {
-	DEBUG = d
-	LEVEL = verbosity
-}
-
 // StreamToBits converts samples to bits using the bitlength specified.
+// The bitlength can be fractional, the sample closest to each bit center is used.
 // Observe that POCSAG signifies a high bit with a low frequency.
-func StreamToBits(stream []int16, bitlength int) []datatypes.Bit {
+func StreamToBits(stream []int16, bitlength float64) []datatypes.Bit {
 
-	bits := make([]datatypes.Bit, (len(stream)/bitlength)+1)
-	b := 0
+	bits := []datatypes.Bit{}
 
-	for a := 0; a < len(stream); a += bitlength {
+	for pos := 0.0; int(pos+0.5) < len(stream); pos += bitlength {
 
-		sample := stream[a]
+		a := int(pos + 0.5)
+		sample := int32(stream[a])
 		if a > 2 && a < len(stream)-2 {
 			// let the samples before and after influence our sample, to prevent spike errors
-			sample = (stream[a-1] / 2) + stream[a] + (stream[a+1] / 2)
+			// summed as int32 since strong signals would overflow int16
+			sample = int32(stream[a-1]/2) + sample + int32(stream[a+1]/2)
 		}
 
-		bits[b] = datatypes.Bit((sample < 0))
-		b += 1
+		bits = append(bits, datatypes.Bit((sample < 0)))
 
 	}
 
@@ -134,7 +127,7 @@ func BitcodedDecimals(bits []datatypes.Bit) string {
 		mod := a % bitsPerByte
 
 		if mod == 0 && a > 0 {
-			msg += bcdChar(foo)
+			msg += BcdChar(foo)
 			foo = 0
 		}
 
@@ -144,14 +137,15 @@ func BitcodedDecimals(bits []datatypes.Bit) string {
 	}
 
 	if len(bits)%bitsPerByte == 0 {
-		msg += bcdChar(foo)
+		msg += BcdChar(foo)
 	}
 
-	return msg
+	// the last codeword is padded with spaces
+	return strings.TrimRight(msg, " ")
 }
 
-// bcdChar translates digits and non-digit bitcoded entitis to charaters as per POCSAG protocol
-func bcdChar(foo uint8) string {
+// BcdChar translates digits and non-digit bitcoded entitis to charaters as per POCSAG protocol
+func BcdChar(foo uint8) string {
 
 	if foo < 10 {
 		return fmt.Sprintf("%d", foo)
@@ -228,3 +222,38 @@ func PrintUint32(i uint32) {
 	}
 	println("")
 }
+
+// Uint32ToBits converts a 32 bit word to bits in MSB to LSB order.
+func Uint32ToBits(word uint32) []datatypes.Bit {
+	bits := make([]datatypes.Bit, 32)
+	for a := 0; a < 32; a += 1 {
+		bits[a] = datatypes.Bit((word>>uint(31-a))&1 == 1)
+	}
+	return bits
+}
+
+// PackBits packs up to 32 bits in MSB to LSB order, the reverse of Uint32ToBits
+func PackBits(bits []datatypes.Bit) uint32 {
+	var word uint32
+	for _, b := range bits {
+		word = (word << 1) | uint32(b.UInt8())
+	}
+	return word
+}
+
+// SampleTime returns the time into a stream of a sample offset. Computed in
+// floating point, since the offset in nanoseconds overflows for long streams.
+func SampleTime(offset int64, samplerate int) time.Duration {
+	return time.Duration(float64(offset) * float64(time.Second) / float64(samplerate))
+}
+
+// Clip converts a sample to int16 without wrapping around
+func Clip(x float64) int16 {
+	if x > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if x < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(x)
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	. "gopkg.in/check.v1"
 	"testing"
+	"time"
 
 	"github.com/dhogborg/go-pocsag/internal/datatypes"
 )
@@ -136,3 +137,51 @@ func (f *UtilitiesSuite) Test_BCD_10chars(c *C) {
 
 	c.Assert(BitcodedDecimals(bits), Equals, "0707193385")
 }
+
+func (f *UtilitiesSuite) Test_StreamToBits_Fractional(c *C) {
+	// 1200 baud at 44100 Hz, 36.75 samples per bit
+	bits := []bool{true, false, false, true, true, true, false, true, false, false}
+
+	stream := []int16{}
+	for a := 0; a < int(float64(len(bits))*36.75); a += 1 {
+		if bits[int(float64(a)/36.75)] {
+			stream = append(stream, -1000)
+		} else {
+			stream = append(stream, 1000)
+		}
+	}
+
+	// start in the center of the first bit
+	decoded := StreamToBits(stream[18:], 36.75)
+
+	c.Assert(len(decoded), Equals, len(bits))
+	for i, b := range bits {
+		c.Assert(bool(decoded[i]), Equals, b)
+	}
+}
+
+func (f *UtilitiesSuite) Test_Uint32ToBits(c *C) {
+	bits := Uint32ToBits(0x7CD215D8)
+	c.Assert(len(bits), Equals, 32)
+	c.Assert(Btouint32(MSBBitsToBytes(bits, 8)), Equals, uint32(0x7CD215D8))
+}
+
+func (f *UtilitiesSuite) Test_PackBits_Roundtrip(c *C) {
+	for _, word := range []uint32{0, 1, 0x7CD215D8, 0x7A89C197, 0xFFFFFFFF, 0x80000000} {
+		c.Assert(PackBits(Uint32ToBits(word)), Equals, word)
+	}
+
+	// fewer than 32 bits are packed in the low bits
+	c.Assert(PackBits(Uint32ToBits(0x7CD215D8)[28:]), Equals, uint32(0x8))
+}
+
+func (f *UtilitiesSuite) Test_Clip(c *C) {
+	c.Assert(Clip(40000), Equals, int16(32767))
+	c.Assert(Clip(-40000), Equals, int16(-32768))
+	c.Assert(Clip(-1234.5), Equals, int16(-1234))
+}
+
+func (f *UtilitiesSuite) Test_SampleTime_Long_Stream(c *C) {
+	// 24 hours at 2.4 MHz, the offset in nanoseconds overflows int64
+	c.Assert(SampleTime(24*3600*2400000, 2400000), Equals, 24*time.Hour)
+}
@@ -0,0 +1,216 @@
+package wav
+
+import (
+	"bufio"
+	bin "encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dhogborg/go-pocsag/internal/utils"
+)
+
+// frames converted per read from the data chunk
+const READ_FRAMES = 4096
+
+// Reader streams the samples of a wav file as signed 16 bit little endian,
+// with the channels interleaved. Only the header is read when the reader is
+// created, the data is converted as it is read.
+type Reader struct {
+	*WavData
+
+	source io.Reader
+	data   io.Reader
+
+	// offset of the data chunk in the source, when it can seek
+	start int64
+	// number of frames in the data chunk, -1 if unknown
+	frames int64
+	// frames read from the data chunk
+	position int64
+
+	raw     []byte
+	pending []byte
+	closer  io.Closer
+}
+
+// Open opens a wav file from disk for streaming
+func Open(fn string) (*Reader, error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closer = file
+
+	return reader, nil
+}
+
+// NewReader reads the header of the wav file. Seeking to an earlier offset
+// requires the source to implement io.Seeker.
+func NewReader(source io.Reader) (*Reader, error) {
+
+	wav, err := ReadHeader(source)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{
+		WavData: wav,
+		source:  source,
+		frames:  -1,
+		raw:     make([]byte, READ_FRAMES*int(wav.BlockAlign)),
+	}
+
+	size := int64(-1)
+	if wav.DataSize != 0 && wav.DataSize != 0xFFFFFFFF {
+		size = int64(wav.DataSize)
+	}
+
+	if seeker, ok := source.(io.Seeker); ok {
+		if r.start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+
+		// the size is missing in unfinished recordings, the file size is used
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 || size > end-r.start {
+			size = end - r.start
+		}
+
+		if _, err := seeker.Seek(r.start, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	if size >= 0 {
+		r.frames = size / int64(wav.BlockAlign)
+	}
+	r.reset()
+
+	return r, nil
+}
+
+// reset limits the data reader to the frames after the position
+func (r *Reader) reset() {
+	r.pending = nil
+	if r.frames < 0 {
+		r.data = bufio.NewReader(r.source)
+		return
+	}
+	remaining := (r.frames - r.position) * int64(r.BlockAlign)
+	r.data = bufio.NewReader(io.LimitReader(r.source, remaining))
+}
+
+// Read reads converted samples, two bytes per sample
+func (r *Reader) Read(p []byte) (int, error) {
+
+	if len(r.pending) == 0 {
+		n, err := io.ReadFull(r.data, r.raw)
+		if err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+
+		// a truncated file may end in the middle of a frame
+		n -= n % int(r.BlockAlign)
+		if n == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		r.position += int64(n / int(r.BlockAlign))
+
+		samples := r.Int16(r.raw[:n])
+		buffer := make([]byte, len(samples)*2)
+		for i, sample := range samples {
+			bin.LittleEndian.PutUint16(buffer[i*2:], uint16(sample))
+		}
+		r.pending = buffer
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Seek moves the reader to a time offset from the start of the data.
+// Sources that can not seek are read forward to the offset.
+func (r *Reader) Seek(offset time.Duration) error {
+
+	if offset < 0 {
+		return fmt.Errorf("invalid offset: %s", offset)
+	}
+
+	frame := int64(offset.Seconds()*float64(r.SampleRate) + 0.5)
+	if r.frames >= 0 && frame > r.frames {
+		return fmt.Errorf("offset %s is beyond the end of the file (%s)", offset, r.Duration())
+	}
+
+	if seeker, ok := r.source.(io.Seeker); ok {
+		if _, err := seeker.Seek(r.start+frame*int64(r.BlockAlign), io.SeekStart); err != nil {
+			return err
+		}
+		r.position = frame
+		r.reset()
+		return nil
+	}
+
+	// pending samples are already read from the source
+	buffered := int64(len(r.pending) / 2 / int(r.NumChannels))
+	if frame < r.position-buffered {
+		return fmt.Errorf("wav input can not seek backwards")
+	}
+
+	if frame < r.position {
+		keep := int(r.position-frame) * int(r.NumChannels) * 2
+		r.pending = r.pending[len(r.pending)-keep:]
+		return nil
+	}
+
+	skip := (frame - r.position) * int64(r.BlockAlign)
+	r.pending = nil
+	n, err := io.CopyN(io.Discard, r.data, skip)
+	r.position += n / int64(r.BlockAlign)
+	if err == io.EOF {
+		return fmt.Errorf("offset %s is beyond the end of the file", offset)
+	}
+	return err
+}
+
+// Frames returns the number of frames in the data chunk, -1 if the size is
+// unknown, such as a stream without a size in the header.
+func (r *Reader) Frames() int64 {
+	return r.frames
+}
+
+// Duration returns the length of the data, 0 if unknown
+func (r *Reader) Duration() time.Duration {
+	if r.frames < 0 {
+		return 0
+	}
+	return utils.SampleTime(r.frames, int(r.SampleRate))
+}
+
+// Position returns the time offset of the next frame to be read
+func (r *Reader) Position() time.Duration {
+	buffered := int64(len(r.pending) / 2 / int(r.NumChannels))
+	return utils.SampleTime(r.position-buffered, int(r.SampleRate))
+}
+
+// Close closes the file if the reader was opened with Open
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
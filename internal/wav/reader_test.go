@@ -0,0 +1,149 @@
+package wav
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ReaderSuite{})
+
+type ReaderSuite struct{}
+
+// ramp returns a mono 8000 Hz wav file with the sample values 0, 1, 2...
+func ramp(count int) []byte {
+	values := make([]int16, count)
+	for i := range values {
+		values[i] = int16(i)
+	}
+	return riff(formatChunk(WAVE_FORMAT_PCM, 1, 8000, 16), chunk("data", pcm16(values...)))
+}
+
+// onlyReader hides the Seek method of the source
+type onlyReader struct {
+	io.Reader
+}
+
+func (f *ReaderSuite) Test_Header_Metadata(c *C) {
+	reader, err := NewReader(bytes.NewReader(ramp(12000)))
+	c.Assert(err, IsNil)
+	c.Assert(reader.SampleRate, Equals, uint32(8000))
+	c.Assert(reader.NumChannels, Equals, uint16(1))
+	c.Assert(reader.Frames(), Equals, int64(12000))
+	c.Assert(reader.Duration(), Equals, 1500*time.Millisecond)
+	c.Assert(reader.Position(), Equals, time.Duration(0))
+}
+
+func (f *ReaderSuite) Test_Missing_Size(c *C) {
+	// the length of an unfinished recording is taken from the file size
+	data := riff(formatChunk(WAVE_FORMAT_PCM, 1, 8000, 16), chunk("data", nil))
+	data = append(data, pcm16(make([]int16, 4000)...)...)
+
+	reader, err := NewReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(reader.Duration(), Equals, 500*time.Millisecond)
+
+	// and unknown from a stream
+	reader, err = NewReader(onlyReader{bytes.NewReader(data)})
+	c.Assert(err, IsNil)
+	c.Assert(reader.Frames(), Equals, int64(-1))
+	c.Assert(reader.Duration(), Equals, time.Duration(0))
+
+	read, err := io.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(len(read), Equals, 8000)
+}
+
+func (f *ReaderSuite) Test_Streaming(c *C) {
+	reader, err := NewReader(bytes.NewReader(ramp(10000)))
+	c.Assert(err, IsNil)
+
+	// small reads are served from the converted samples
+	p := make([]byte, 6)
+	n, err := reader.Read(p)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 6)
+	c.Assert(p, DeepEquals, pcm16(0, 1, 2))
+	c.Assert(reader.Position(), Equals, 375*time.Microsecond)
+
+	rest, err := io.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(len(rest), Equals, (10000-3)*2)
+	c.Assert(rest[len(rest)-2:], DeepEquals, pcm16(9999))
+}
+
+func (f *ReaderSuite) Test_Seek(c *C) {
+	for _, source := range []io.Reader{
+		bytes.NewReader(ramp(16000)),
+		onlyReader{bytes.NewReader(ramp(16000))},
+	} {
+		reader, err := NewReader(source)
+		c.Assert(err, IsNil)
+
+		c.Assert(reader.Seek(time.Second), IsNil)
+		c.Assert(reader.Position(), Equals, time.Second)
+		c.Assert(first(reader), Equals, int16(8000))
+
+		// forward within the samples already converted
+		c.Assert(reader.Seek(time.Second+time.Millisecond), IsNil)
+		c.Assert(first(reader), Equals, int16(8008))
+
+		c.Assert(reader.Seek(3*time.Second), ErrorMatches, "offset 3s is beyond the end of the file.*")
+	}
+
+	reader, err := NewReader(bytes.NewReader(ramp(16000)))
+	c.Assert(err, IsNil)
+	_, err = io.ReadAll(reader)
+	c.Assert(err, IsNil)
+
+	c.Assert(reader.Seek(250*time.Millisecond), IsNil)
+	c.Assert(first(reader), Equals, int16(2000))
+
+	reader, err = NewReader(onlyReader{bytes.NewReader(ramp(16000))})
+	c.Assert(err, IsNil)
+	_, err = io.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(reader.Seek(250*time.Millisecond), ErrorMatches, "wav input can not seek backwards")
+}
+
+func (f *ReaderSuite) Test_Open(c *C) {
+	fn := filepath.Join(c.MkDir(), "ramp.wav")
+	c.Assert(os.WriteFile(fn, ramp(8000), 0644), IsNil)
+
+	reader, err := Open(fn)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+
+	c.Assert(reader.Duration(), Equals, time.Second)
+	c.Assert(reader.Seek(500*time.Millisecond), IsNil)
+	c.Assert(first(reader), Equals, int16(4000))
+}
+
+// first reads one sample
+func first(r io.Reader) int16 {
+	p := make([]byte, 2)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return -1
+	}
+	return int16(p[0]) | int16(p[1])<<8
+}
+
+func (f *ReaderSuite) Test_Stereo(c *C) {
+	data := riff(formatChunk(WAVE_FORMAT_PCM, 2, 8000, 16), chunk("data", pcm16(1, -1, 2, -2, 3, -3)))
+
+	wav, err := Read(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(wav.FrameCount(), Equals, 3)
+	c.Assert(wav.ChannelSample(2, 0), Equals, int16(3))
+	c.Assert(wav.ChannelSample(2, 1), Equals, int16(-3))
+
+	reader, err := NewReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(reader.Seek(250*time.Microsecond), IsNil)
+	c.Assert(first(reader), Equals, int16(3))
+	c.Assert(first(reader), Equals, int16(-3))
+}
@@ -2,70 +2,281 @@ package wav
 
 import (
 	"bufio"
+	"bytes"
 	bin "encoding/binary"
+	"fmt"
+	"io"
+	"math"
 	"os"
+
+	"github.com/dhogborg/go-pocsag/internal/utils"
 )
 
+const (
+	WAVE_FORMAT_PCM        uint16 = 0x0001
+	WAVE_FORMAT_IEEE_FLOAT uint16 = 0x0003
+	WAVE_FORMAT_EXTENSIBLE uint16 = 0xFFFE
+
+	// largest fmt chunk accepted, an extensible format needs 40 bytes
+	MAX_FMT_SIZE uint32 = 1024
+)
+
+// the GUID of an extensible format ends with these bytes, the format code is
+// the first 2 bytes
+var extensibleGUID = []byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+// WavData holds the format of a wav file and the samples converted to signed
+// 16 bit little endian, with the channels interleaved.
+// AudioFormat is PCM or IEEE float, the format of an extensible file is
+// resolved from its sub format.
 type WavData struct {
-	bChunkID  [4]byte // B
-	ChunkSize uint32  // L
-	bFormat   [4]byte // B
-
-	bSubchunk1ID  [4]byte // B
-	Subchunk1Size uint32  // L
-	AudioFormat   uint16  // L
-	NumChannels   uint16  // L
-	SampleRate    uint32  // L
-	ByteRate      uint32  // L
-	BlockAlign    uint16  // L
-	BitsPerSample uint16  // L
-
-	bSubchunk2ID  [4]byte // B
-	Subchunk2Size uint32  // L
-	Data          []byte  // L
+	AudioFormat   uint16
+	NumChannels   uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+
+	// size of the data chunk in bytes, as given by the header
+	DataSize uint32
+	Data     []byte
 }
 
+// NewWavData reads a wav file from disk
 func NewWavData(fn string) (*WavData, error) {
-	res, err := os.OpenFile(fn, os.O_RDONLY, 0)
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(bufio.NewReader(file))
+}
+
+// Read reads a wav file and converts the samples to 16 bit
+func Read(r io.Reader) (*WavData, error) {
+
+	reader, err := NewReader(r)
 	if err != nil {
 		return nil, err
 	}
-	file := bufio.NewReader(res)
+
+	reader.Data, err = io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return reader.WavData, nil
+}
+
+// ReadHeader reads the RIFF header and walks the chunks up to the data chunk.
+// The format is validated, and other chunks such as LIST and fact are skipped.
+// The reader is left at the first sample of the data chunk.
+func ReadHeader(r io.Reader) (*WavData, error) {
+
+	var riff [4]byte
+	var size uint32
+	var wave [4]byte
+
+	if err := readFields(r, &riff, &size, &wave); err != nil {
+		return nil, fmt.Errorf("invalid wav header: %s", err)
+	}
+	if string(riff[:]) != "RIFF" {
+		return nil, fmt.Errorf("not a RIFF file")
+	}
+	if string(wave[:]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAVE file: %q", wave[:])
+	}
+
+	var wav *WavData
+
+	for {
+		var id [4]byte
+		var chunksize uint32
+
+		if err := readFields(r, &id, &chunksize); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("no data chunk in wav file")
+			}
+			return nil, fmt.Errorf("invalid chunk header: %s", err)
+		}
+
+		// chunks are padded to an even size
+		padded := int64(chunksize) + int64(chunksize%2)
+
+		switch string(id[:]) {
+		case "fmt ":
+			if chunksize > MAX_FMT_SIZE {
+				return nil, fmt.Errorf("fmt chunk too large: %d bytes", chunksize)
+			}
+			chunk := make([]byte, padded)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return nil, fmt.Errorf("invalid fmt chunk: %s", err)
+			}
+
+			var err error
+			wav, err = parseFormat(chunk[:chunksize])
+			if err != nil {
+				return nil, err
+			}
+
+		case "data":
+			if wav == nil {
+				return nil, fmt.Errorf("data chunk before fmt chunk")
+			}
+			wav.DataSize = chunksize
+			return wav, nil
+
+		default:
+			if _, err := io.CopyN(io.Discard, r, padded); err != nil {
+				return nil, fmt.Errorf("invalid %q chunk: %s", id[:], err)
+			}
+		}
+	}
+}
+
+// parseFormat reads and validates the contents of the fmt chunk
+func parseFormat(chunk []byte) (*WavData, error) {
+
+	if len(chunk) < 16 {
+		return nil, fmt.Errorf("fmt chunk too short: %d bytes", len(chunk))
+	}
 
 	wav := &WavData{}
-	bin.Read(file, bin.BigEndian, &wav.bChunkID)
-	bin.Read(file, bin.LittleEndian, &wav.ChunkSize)
-	bin.Read(file, bin.BigEndian, &wav.bFormat)
+	readFields(bytes.NewReader(chunk), &wav.AudioFormat, &wav.NumChannels, &wav.SampleRate,
+		&wav.ByteRate, &wav.BlockAlign, &wav.BitsPerSample)
 
-	bin.Read(file, bin.BigEndian, &wav.bSubchunk1ID)
-	bin.Read(file, bin.LittleEndian, &wav.Subchunk1Size)
-	bin.Read(file, bin.LittleEndian, &wav.AudioFormat)
-	bin.Read(file, bin.LittleEndian, &wav.NumChannels)
-	bin.Read(file, bin.LittleEndian, &wav.SampleRate)
-	bin.Read(file, bin.LittleEndian, &wav.ByteRate)
-	bin.Read(file, bin.LittleEndian, &wav.BlockAlign)
-	bin.Read(file, bin.LittleEndian, &wav.BitsPerSample)
+	if wav.AudioFormat == WAVE_FORMAT_EXTENSIBLE {
+		// cbSize, valid bits, channel mask and the sub format GUID
+		if len(chunk) < 40 {
+			return nil, fmt.Errorf("extensible fmt chunk too short: %d bytes", len(chunk))
+		}
+		if !bytes.Equal(chunk[26:40], extensibleGUID) {
+			return nil, fmt.Errorf("unsupported extensible sub format")
+		}
+		wav.AudioFormat = bin.LittleEndian.Uint16(chunk[24:26])
+	}
 
-	bin.Read(file, bin.BigEndian, &wav.bSubchunk2ID)
-	bin.Read(file, bin.LittleEndian, &wav.Subchunk2Size)
+	switch wav.AudioFormat {
+	case WAVE_FORMAT_PCM:
+		if wav.BitsPerSample != 8 && wav.BitsPerSample != 16 && wav.BitsPerSample != 24 && wav.BitsPerSample != 32 {
+			return nil, fmt.Errorf("unsupported bits per sample for PCM: %d", wav.BitsPerSample)
+		}
+	case WAVE_FORMAT_IEEE_FLOAT:
+		if wav.BitsPerSample != 32 && wav.BitsPerSample != 64 {
+			return nil, fmt.Errorf("unsupported bits per sample for float: %d", wav.BitsPerSample)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported audio format: 0x%04X", wav.AudioFormat)
+	}
 
-	wav.Data = make([]byte, wav.Subchunk2Size)
-	bin.Read(file, bin.LittleEndian, &wav.Data)
+	if wav.NumChannels == 0 {
+		return nil, fmt.Errorf("invalid number of channels: 0")
+	}
+
+	if wav.SampleRate == 0 {
+		return nil, fmt.Errorf("invalid samplerate: 0")
+	}
+
+	if int(wav.BlockAlign) != int(wav.NumChannels)*int(wav.BitsPerSample)/8 {
+		return nil, fmt.Errorf("invalid block align %d for %d channels of %d bits",
+			wav.BlockAlign, wav.NumChannels, wav.BitsPerSample)
+	}
 
 	return wav, nil
 }
 
+// Int16 converts whole frames of data in the format of the file to 16 bit samples
+func (w *WavData) Int16(data []byte) []int16 {
+
+	size := int(w.BitsPerSample / 8)
+	samples := make([]int16, len(data)/size)
+
+	for i := range samples {
+		b := data[i*size : i*size+size]
+
+		switch {
+		case w.AudioFormat == WAVE_FORMAT_IEEE_FLOAT && size == 4:
+			samples[i] = utils.Clip(float64(math.Float32frombits(bin.LittleEndian.Uint32(b))) * math.MaxInt16)
+		case w.AudioFormat == WAVE_FORMAT_IEEE_FLOAT:
+			samples[i] = utils.Clip(math.Float64frombits(bin.LittleEndian.Uint64(b)) * math.MaxInt16)
+		case size == 1:
+			// 8 bit samples are unsigned
+			samples[i] = (int16(b[0]) - 128) << 8
+		default:
+			// the most significant 16 bits
+			samples[i] = int16(bin.LittleEndian.Uint16(b[size-2:]))
+		}
+	}
+
+	return samples
+}
+
+// SampleCount returns the number of samples of all channels
 func (w *WavData) SampleCount() int {
 	return int(len(w.Data) / 2)
 }
 
+// Sample returns a sample by its index in the interleaved data
 func (w *WavData) Sample(index int) int16 {
 	in := index * 2
 	return btoi16(w.Data[in : in+2])
 }
 
+// FrameCount returns the number of samples in each channel
+func (w *WavData) FrameCount() int {
+	return w.SampleCount() / int(w.NumChannels)
+}
+
+// ChannelSample returns the sample of a channel, counted from 0, in a frame
+func (w *WavData) ChannelSample(frame int, channel int) int16 {
+	return w.Sample(frame*int(w.NumChannels) + channel)
+}
+
 func btoi16(b []byte) int16 {
 	value := int16(b[0])
 	value += int16(b[1]) << 8
 	return value
 }
+
+// readFields reads little endian values in order
+func readFields(r io.Reader, fields ...interface{}) error {
+	for _, field := range fields {
+		if err := bin.Read(r, bin.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes the samples as a mono 16 bit PCM wav file
+func Write(w io.Writer, samplerate uint32, samples []int16) error {
+
+	datasize := uint32(len(samples) * 2)
+
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(36 + datasize),
+		[4]byte{'W', 'A', 'V', 'E'},
+
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),             // Subchunk1Size
+		uint16(1),              // AudioFormat, PCM
+		uint16(1),              // NumChannels
+		samplerate,             // SampleRate
+		uint32(samplerate * 2), // ByteRate
+		uint16(2),              // BlockAlign
+		uint16(16),             // BitsPerSample
+
+		[4]byte{'d', 'a', 't', 'a'},
+		datasize,
+	}
+
+	for _, field := range header {
+		if err := bin.Write(w, bin.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	return bin.Write(w, bin.LittleEndian, samples)
+}
@@ -0,0 +1,206 @@
+package wav
+
+import (
+	"bytes"
+	bin "encoding/binary"
+	"math"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&WavSuite{})
+
+type WavSuite struct{}
+
+func (f *WavSuite) Test_Write_Read_Roundtrip(c *C) {
+	buffer := &bytes.Buffer{}
+	c.Assert(Write(buffer, 22050, []int16{0, 1000, -1000, math.MaxInt16}), IsNil)
+
+	wav, err := Read(buffer)
+	c.Assert(err, IsNil)
+	c.Assert(wav.SampleRate, Equals, uint32(22050))
+	c.Assert(wav.NumChannels, Equals, uint16(1))
+	c.Assert(samples(wav), DeepEquals, []int16{0, 1000, -1000, math.MaxInt16})
+}
+
+func (f *WavSuite) Test_Skips_Chunks(c *C) {
+	// Audacity writes LIST chunks, odd sizes are padded
+	data := riff(
+		chunk("LIST", []byte("INFOISFT\x05\x00\x00\x00Lavf\x00")),
+		formatChunk(WAVE_FORMAT_PCM, 1, 48000, 16),
+		chunk("fact", []byte{4, 0, 0, 0}),
+		chunk("data", pcm16(100, -100)),
+	)
+
+	wav, err := Read(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(samples(wav), DeepEquals, []int16{100, -100})
+}
+
+func (f *WavSuite) Test_Data_Chunk_Size(c *C) {
+	// trailing chunks after the data are not read as samples
+	data := riff(
+		formatChunk(WAVE_FORMAT_PCM, 1, 48000, 16),
+		chunk("data", pcm16(1, 2)),
+		chunk("LIST", []byte("INFO")),
+	)
+
+	wav, err := Read(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(samples(wav), DeepEquals, []int16{1, 2})
+
+	// an unfinished recording has no data size
+	data = riff(formatChunk(WAVE_FORMAT_PCM, 1, 48000, 16), chunk("data", nil))
+	data = append(data, pcm16(3, 4, 5)...)
+
+	wav, err = Read(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(samples(wav), DeepEquals, []int16{3, 4, 5})
+}
+
+func (f *WavSuite) Test_Bit_Depths(c *C) {
+	tests := []struct {
+		format uint16
+		bits   uint16
+		data   []byte
+	}{
+		{WAVE_FORMAT_PCM, 8, []byte{0x80, 0xC0, 0x00}},
+		{WAVE_FORMAT_PCM, 24, []byte{0x00, 0x00, 0x00, 0xFF, 0x00, 0x40, 0x00, 0x00, 0x80}},
+		{WAVE_FORMAT_PCM, 32, []byte{0, 0, 0, 0, 0xFF, 0xFF, 0x00, 0x40, 0, 0, 0, 0x80}},
+		{WAVE_FORMAT_IEEE_FLOAT, 32, float32s(0, 0.5, -1)},
+		{WAVE_FORMAT_IEEE_FLOAT, 64, float64s(0, 0.5, -1)},
+	}
+
+	for _, t := range tests {
+		wav, err := Read(bytes.NewReader(riff(formatChunk(t.format, 1, 8000, t.bits), chunk("data", t.data))))
+		c.Assert(err, IsNil)
+
+		s := samples(wav)
+		c.Assert(len(s), Equals, 3)
+		c.Assert(s[0], Equals, int16(0))
+		c.Assert(s[1] > 16000 && s[1] < 16500, Equals, true)
+		c.Assert(s[2] <= -32767, Equals, true)
+	}
+}
+
+func (f *WavSuite) Test_Extensible(c *C) {
+	wav, err := Read(bytes.NewReader(riff(
+		extensibleChunk(WAVE_FORMAT_IEEE_FLOAT, 2, 32),
+		chunk("data", float32s(0.5, -0.5)),
+	)))
+	c.Assert(err, IsNil)
+	c.Assert(wav.AudioFormat, Equals, WAVE_FORMAT_IEEE_FLOAT)
+	c.Assert(wav.NumChannels, Equals, uint16(2))
+	c.Assert(samples(wav), DeepEquals, []int16{16383, -16383})
+}
+
+func (f *WavSuite) Test_Validation(c *C) {
+	tests := []struct {
+		data  []byte
+		error string
+	}{
+		{[]byte("RIFX\x00\x00\x00\x00WAVE"), "not a RIFF file"},
+		{[]byte("RIFF\x00\x00\x00\x00AVI "), "not a WAVE file.*"},
+		{riff(chunk("data", pcm16(1))), "data chunk before fmt chunk"},
+		{riff(formatChunk(WAVE_FORMAT_PCM, 1, 8000, 16)), "no data chunk in wav file"},
+		{riff(formatChunk(0x0055, 1, 8000, 16), chunk("data", nil)), "unsupported audio format: 0x0055"},
+		{riff(formatChunk(WAVE_FORMAT_PCM, 1, 8000, 12), chunk("data", nil)), "unsupported bits per sample for PCM: 12"},
+		{riff(formatChunk(WAVE_FORMAT_IEEE_FLOAT, 1, 8000, 16), chunk("data", nil)), "unsupported bits per sample for float: 16"},
+		{riff(formatChunk(WAVE_FORMAT_PCM, 0, 8000, 16), chunk("data", nil)), "invalid number of channels: 0"},
+		{riff(formatChunk(WAVE_FORMAT_PCM, 1, 0, 16), chunk("data", nil)), "invalid samplerate: 0"},
+		{riff(chunk("fmt ", []byte{1, 0}), chunk("data", nil)), "fmt chunk too short: 2 bytes"},
+		{riff(chunk("LIST", []byte("INFO")))[:20], "invalid .* chunk.*"},
+		{[]byte("RIFF\x10\x00\x00\x00WAVEfmt \xFF\xFF\xFF\xFF"), "fmt chunk too large: 4294967295 bytes"},
+		{[]byte("RIFF\x10\x00\x00\x00WAVEfmt \x01\x04\x00\x00"), "fmt chunk too large: 1025 bytes"},
+		{[]byte("RIFF\x10\x00\x00\x00WAVELIST\xFF\xFF\xFF\xFF"), "invalid \"LIST\" chunk: EOF"},
+	}
+
+	for _, t := range tests {
+		_, err := Read(bytes.NewReader(t.data))
+		c.Assert(err, ErrorMatches, t.error)
+	}
+
+	// block align not matching the channels and bits
+	format := formatChunk(WAVE_FORMAT_PCM, 2, 8000, 16)
+	format[20] = 2
+	_, err := Read(bytes.NewReader(riff(format, chunk("data", nil))))
+	c.Assert(err, ErrorMatches, "invalid block align 2 for 2 channels of 16 bits")
+}
+
+// riff returns a wave file with the chunks
+func riff(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, ch := range chunks {
+		body = append(body, ch...)
+	}
+	return append(chunk("RIFF", body)[:8], body...)
+}
+
+// chunk returns the chunk header and data, padded to an even size
+func chunk(id string, data []byte) []byte {
+	b := []byte(id)
+	b = bin.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func formatChunk(format uint16, channels uint16, samplerate uint32, bits uint16) []byte {
+	align := channels * bits / 8
+
+	b := bin.LittleEndian.AppendUint16(nil, format)
+	b = bin.LittleEndian.AppendUint16(b, channels)
+	b = bin.LittleEndian.AppendUint32(b, samplerate)
+	b = bin.LittleEndian.AppendUint32(b, samplerate*uint32(align))
+	b = bin.LittleEndian.AppendUint16(b, align)
+	b = bin.LittleEndian.AppendUint16(b, bits)
+	return chunk("fmt ", b)
+}
+
+func extensibleChunk(format uint16, channels uint16, bits uint16) []byte {
+	b := formatChunk(WAVE_FORMAT_EXTENSIBLE, channels, 48000, bits)[8:]
+	b = bin.LittleEndian.AppendUint16(b, 22)   // cbSize
+	b = bin.LittleEndian.AppendUint16(b, bits) // valid bits
+	b = bin.LittleEndian.AppendUint32(b, 3)    // channel mask, front left and right
+	b = bin.LittleEndian.AppendUint16(b, format)
+	b = append(b, extensibleGUID...)
+	return chunk("fmt ", b)
+}
+
+func pcm16(values ...int16) []byte {
+	b := []byte{}
+	for _, v := range values {
+		b = bin.LittleEndian.AppendUint16(b, uint16(v))
+	}
+	return b
+}
+
+func float32s(values ...float32) []byte {
+	b := []byte{}
+	for _, v := range values {
+		b = bin.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return b
+}
+
+func float64s(values ...float64) []byte {
+	b := []byte{}
+	for _, v := range values {
+		b = bin.LittleEndian.AppendUint64(b, math.Float64bits(v))
+	}
+	return b
+}
+
+func samples(wav *WavData) []int16 {
+	s := make([]int16, wav.SampleCount())
+	for i := range s {
+		s[i] = wav.Sample(i)
+	}
+	return s
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/fatih/color"
 
-	"github.com/dhogborg/go-pocsag/internal/datatypes"
-	"github.com/dhogborg/go-pocsag/internal/pocsag"
-	"github.com/dhogborg/go-pocsag/internal/utils"
+	"github.com/dhogborg/go-pocsag/pocsag"
 )
 
 var (
@@ -24,11 +28,25 @@ var (
 
 type Config struct {
 	input       string
+	start       time.Duration
+	recorded    string
 	output      string
+	record      bool
 	baud        int
+	parallel    bool
+	samplerate  int
 	debug       bool
 	messagetype pocsag.MessageType
+	charset     pocsag.Charset
+	charsets    map[uint32]pocsag.Charset
 	verbosity   int
+	format      string
+	inputformat pocsag.InputFormat
+	channel     string
+	iq          pocsag.IQOptions
+	syncerrors  int
+	polarity    pocsag.Polarity
+	filter      pocsag.FilterOptions
 }
 
 func main() {
@@ -43,11 +61,54 @@ func main() {
 			Value: "",
 			Usage: "wav file with signed 16 bit ints, - for sttdin",
 		},
+		cli.DurationFlag{
+			Name:  "start",
+			Usage: "Start decoding a wav file at a time offset, e.g. 1h20m",
+		},
+		cli.StringFlag{
+			Name:  "recorded",
+			Value: "",
+			Usage: "Time the recording started, as 2006-01-02 15:04:05 local time or RFC3339. Default for wav files is the modification time less the duration",
+		},
+		cli.StringFlag{
+			Name:  "channel",
+			Value: "1",
+			Usage: "Channel of a multichannel wav file: 1 or left, 2 or right, or all to decode every channel in parallel",
+		},
+		cli.StringFlag{
+			Name:  "input-format",
+			Value: "audio",
+			Usage: "Input format: audio, iq-u8 (rtl_sdr), iq-s16, iq-f32, bin (packed bits), bits (ASCII 0/1), hex (codewords)",
+		},
+		cli.Float64Flag{
+			Name:  "offset",
+			Value: 0,
+			Usage: "Frequency of the channel relative to the center of IQ input, in Hz",
+		},
+		cli.StringFlag{
+			Name:  "channels",
+			Value: "",
+			Usage: "Comma separated offsets of channels in IQ input to decode concurrently, in Hz",
+		},
+		cli.Float64Flag{
+			Name:  "center",
+			Value: 0,
+			Usage: "Frequency the IQ input is centered on, in Hz. Messages are tagged with center + offset",
+		},
+		cli.IntFlag{
+			Name:  "decimation",
+			Value: 0,
+			Usage: "Decimation of IQ input before FM demodulation. Default auto, about 24000 Hz audio",
+		},
 		cli.StringFlag{
 			Name:  "output,o",
 			Value: "",
 			Usage: "Output decoded messages to a folder",
 		},
+		cli.BoolFlag{
+			Name:  "record",
+			Usage: "Save the audio of each transmission as a wav file in the output folder",
+		},
 		cli.IntFlag{
 			Name:  "verbosity",
 			Value: 0,
@@ -56,7 +117,16 @@ func main() {
 		cli.IntFlag{
 			Name:  "baud,b",
 			Value: 0,
-			Usage: "Baud 600/1200/2400. Default auto",
+			Usage: "Baud 512/1200/2400. Default auto detection per transmission",
+		},
+		cli.BoolFlag{
+			Name:  "parallel",
+			Usage: "Run a demodulator for each baudrate concurrently, for channels carrying mixed baudrates",
+		},
+		cli.IntFlag{
+			Name:  "samplerate,s",
+			Value: 48000,
+			Usage: "Samplerate of the input stream. Wav files use the rate from the header",
 		},
 		cli.BoolFlag{
 			Name:  "debug",
@@ -67,22 +137,139 @@ func main() {
 			Value: "auto",
 			Usage: "Force message type: alpha, bcd, auto",
 		},
+		cli.StringFlag{
+			Name:  "charset",
+			Value: "default",
+			Usage: "Charset of alphanumeric messages: " + strings.Join(pocsag.CharsetNames(), ", ") + ", or a file with a custom map",
+		},
+		cli.StringFlag{
+			Name:  "capcode-charset",
+			Value: "",
+			Usage: "Comma separated charsets for single capcodes, as capcode=charset",
+		},
+		cli.IntFlag{
+			Name:  "sync-errors",
+			Value: 2,
+			Usage: "Bit errors accepted in the sync codeword, 0 to 4",
+		},
+		cli.StringFlag{
+			Name:  "polarity",
+			Value: "auto",
+			Usage: "Force bit polarity: auto, normal, inverted",
+		},
+		cli.Float64Flag{
+			Name:  "dc-block",
+			Value: pocsag.DefaultFilter.DCBlock,
+			Usage: "Pole of the DC blocker, 0 disables",
+		},
+		cli.Float64Flag{
+			Name:  "lowpass",
+			Value: pocsag.DefaultFilter.LowPass,
+			Usage: "Low-pass cutoff as a fraction of the baudrate, 0 disables",
+		},
+		cli.Float64Flag{
+			Name:  "agc",
+			Value: pocsag.DefaultFilter.AGC,
+			Usage: "Amplitude targeted by the automatic gain control, 0 disables",
+		},
+		cli.StringFlag{
+			Name:  "format,f",
+			Value: "text",
+			Usage: "Output format: text, json (one object per line)",
+		},
+	}
+
+	app.Commands = []cli.Command{
+		encodeCommand,
 	}
 
 	app.Action = func(c *cli.Context) {
 		config = &Config{
 			input:       c.String("input"),
+			start:       c.Duration("start"),
+			recorded:    c.String("recorded"),
 			output:      c.String("output"),
+			record:      c.Bool("record"),
 			baud:        c.Int("baud"),
+			parallel:    c.Bool("parallel"),
+			samplerate:  c.Int("samplerate"),
 			debug:       c.Bool("debug"),
 			verbosity:   c.Int("verbosity"),
 			messagetype: pocsag.MessageType(c.String("type")),
+			format:      c.String("format"),
+			inputformat: pocsag.InputFormat(c.String("input-format")),
+			channel:     c.String("channel"),
+			syncerrors:  c.Int("sync-errors"),
+			polarity:    pocsag.Polarity(c.String("polarity")),
+			iq: pocsag.IQOptions{
+				Offset:     c.Float64("offset"),
+				Decimation: c.Int("decimation"),
+				Center:     c.Float64("center"),
+			},
+			filter: pocsag.FilterOptions{
+				DCBlock: c.Float64("dc-block"),
+				LowPass: c.Float64("lowpass"),
+				AGC:     c.Float64("agc"),
+			},
+		}
+
+		channels, err := parseChannels(c.String("channels"))
+		if err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+		config.iq.Channels = channels
+
+		config.charset, err = pocsag.GetCharset(c.String("charset"))
+		if err != nil {
+			println(err.Error())
+			os.Exit(1)
 		}
 
-		utils.SetDebug(config.debug, config.verbosity)
-		pocsag.SetDebug(config.debug, config.verbosity)
+		config.charsets, err = parseCapcodeCharsets(c.String("capcode-charset"))
+		if err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
 
-		Run()
+		if config.baud != 0 && !knownBaud(config.baud) {
+			println(fmt.Sprintf("invalid baud: %d", config.baud))
+			os.Exit(1)
+		}
+
+		if config.record && config.output == "" {
+			println("--record requires an output folder")
+			os.Exit(1)
+		}
+
+		if config.syncerrors < 0 || config.syncerrors > pocsag.MAX_SYNC_ERRORS {
+			println(fmt.Sprintf("invalid sync errors: %d, accepted are 0 to %d", config.syncerrors, pocsag.MAX_SYNC_ERRORS))
+			os.Exit(1)
+		}
+
+		if config.polarity != pocsag.PolarityAuto && config.polarity != pocsag.PolarityNormal && config.polarity != pocsag.PolarityInverted {
+			println("invalid polarity: " + string(config.polarity))
+			os.Exit(1)
+		}
+
+		if config.format != "text" && config.format != "json" {
+			println("invalid format: " + config.format)
+			os.Exit(1)
+		}
+
+		// keep stdout clean for the messages when debugging
+		if config.format == "json" {
+			color.Output = os.Stderr
+		}
+
+		if config.inputformat.IsRaw() {
+			RunRaw()
+		} else if config.inputformat == pocsag.InputFormatAudio || config.inputformat.IsIQ() {
+			Run()
+		} else {
+			println("invalid input format: " + string(config.inputformat))
+			os.Exit(1)
+		}
 
 	}
 
@@ -93,33 +280,245 @@ func Run() {
 
 	var source io.Reader
 
+	options := decoderOptions()
+
+	recorded, err := parseTime(config.recorded)
+	if err != nil {
+		println(err.Error())
+		os.Exit(1)
+	}
+	options.StartTime = recorded
+
 	if config.input == "-" || config.input == "" {
 		source = os.Stdin
+	} else if config.inputformat.IsIQ() {
+		// IQ recordings are read as they are, at the samplerate given
+		file, err := os.Open(config.input)
+		if err != nil {
+			println("invalid input: " + err.Error())
+			os.Exit(0)
+		}
+		defer file.Close()
+		source = file
 	} else { // file reading
-		source = pocsag.ReadWav(config.input)
+		reader, err := pocsag.OpenWav(config.input)
+		if err != nil {
+			println("invalid input: " + err.Error())
+			os.Exit(0)
+		}
+		defer reader.Close()
+
+		// the file is last modified when the recording ends
+		if options.StartTime.IsZero() {
+			if info, err := os.Stat(config.input); err == nil {
+				options.StartTime = info.ModTime().Add(-reader.Duration())
+			}
+		}
+
+		if config.start > 0 {
+			if err := reader.Seek(config.start); err != nil {
+				println("invalid start: " + err.Error())
+				os.Exit(1)
+			}
+			options.StartTime = options.StartTime.Add(config.start)
+		}
+
+		source = reader
+		options.SampleRate = int(reader.SampleRate)
+		options.Channels = int(reader.NumChannels)
+
+		if err := selectChannel(&options, config.channel); err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+
+		if config.debug {
+			blue.Printf("Samplerate: %d\n", reader.SampleRate)
+			blue.Printf("Channels: %d\n", reader.NumChannels)
+			blue.Printf("Samples: %d\n", reader.Frames())
+			blue.Printf("Seconds: %0.3f\n", reader.Duration().Seconds())
+		}
+	}
+
+	println("Starting transmission scanner")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	decoder := pocsag.NewDecoder(source, options)
+	err = decoder.Decode(ctx, output)
+
+	if err != nil && err != context.Canceled {
+		println(err.Error())
+	}
+}
+
+// RunRaw parses a dump of already demodulated bits, bypassing the audio scanner
+func RunRaw() {
+
+	var source io.Reader = os.Stdin
+
+	if config.input != "-" && config.input != "" {
+		file, err := os.Open(config.input)
+		if err != nil {
+			println("invalid input: " + err.Error())
+			os.Exit(0)
+		}
+		defer file.Close()
+		source = file
 	}
 
-	if source == nil {
-		println("invalid input")
-		os.Exit(0)
+	bits, err := pocsag.ReadBits(source, config.inputformat)
+	if err != nil {
+		println(err.Error())
+		os.Exit(1)
 	}
 
-	reader := pocsag.NewStreamReader(source, config.baud)
+	for _, m := range pocsag.ParsePOCSAG(bits, decoderOptions()) {
+		output(m)
+	}
+}
 
-	bitstream := make(chan []datatypes.Bit, 1)
-	go reader.StartScan(bitstream)
+// decoderOptions returns the decoder options from the configuration
+func decoderOptions() pocsag.Options {
+	record := ""
+	if config.record {
+		record = config.output
+	}
 
-	for {
-		bits := <-bitstream
-		messages := pocsag.ParsePOCSAG(bits, config.messagetype)
+	return pocsag.Options{
+		SampleRate:      config.samplerate,
+		Input:           config.inputformat,
+		IQ:              config.iq,
+		Baud:            config.baud,
+		Parallel:        config.parallel,
+		MessageType:     config.messagetype,
+		Charset:         config.charset,
+		CapcodeCharsets: config.charsets,
+		SyncErrors:      config.syncerrors,
+		Polarity:        config.polarity,
+		Filter:          config.filter,
+		Record:          record,
+		Debug:           config.debug,
+		Verbosity:       config.verbosity,
+	}
+}
 
-		for _, m := range messages {
-			m.Print(config.messagetype)
+// parseChannels parses a comma separated list of channel offsets
+func parseChannels(list string) ([]float64, error) {
+	channels := []float64{}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
 
-			if config.output != "" {
-				m.Write(config.output, config.messagetype)
-			}
+		offset, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel offset: %s", field)
 		}
+		channels = append(channels, offset)
+	}
+	return channels, nil
+}
+
+// parseCapcodeCharsets parses a comma separated list of capcode=charset
+func parseCapcodeCharsets(list string) (map[uint32]pocsag.Charset, error) {
+	charsets := map[uint32]pocsag.Charset{}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid capcode charset: %s", field)
+		}
+
+		capcode, err := strconv.ParseUint(parts[0], 10, 21)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capcode: %s", parts[0])
+		}
+
+		charset, err := pocsag.GetCharset(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		charsets[uint32(capcode)] = charset
+	}
+	return charsets, nil
+}
+
+// selectChannel sets the audio channel to decode from the channel flag, a
+// number counted from 1, left, right or all
+func selectChannel(options *pocsag.Options, channel string) error {
+	switch strings.ToLower(channel) {
+	case "all":
+		options.AllChannels = true
+		return nil
+	case "left":
+		channel = "1"
+	case "right":
+		channel = "2"
+	}
+
+	number, err := strconv.Atoi(channel)
+	if err != nil || number < 1 || number > options.Channels {
+		return fmt.Errorf("invalid channel: %s, the input has %d channels", channel, options.Channels)
+	}
+	options.Channel = number - 1
+	return nil
+}
+
+// parseTime parses the start time of a recording, in local time or RFC3339.
+// An empty string gives the zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %s", value)
+	}
+	return t, nil
+}
+
+// knownBaud returns true for the baudrates the decoder supports
+func knownBaud(baud int) bool {
+	for _, b := range pocsag.Bauds {
+		if b == baud {
+			return true
+		}
+	}
+	return false
+}
+
+// output prints the message in the configured format and writes it
+// to the output folder if set
+func output(m *pocsag.Message) {
+	if config.format == "json" {
+		printJSON(m)
+	} else {
+		m.Print(config.messagetype)
+	}
+
+	if config.output != "" {
+		m.Write(config.output, config.messagetype)
+	}
+}
 
+// printJSON writes the message to stdout as a single line
+func printJSON(m *pocsag.Message) {
+	b, err := m.JSON(config.messagetype)
+	if err != nil {
+		println(err.Error())
+		return
 	}
+	os.Stdout.Write(append(b, '\n'))
 }
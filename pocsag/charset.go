@@ -0,0 +1,206 @@
+package pocsag
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Charset maps 7 bit characters to the characters they represent in the
+// national variant used by the network. Characters not in the map are kept.
+type Charset map[rune]rune
+
+// DefaultCharset translates the national characters used in Sweden and Germany.
+var DefaultCharset = Charset{
+	'[':  'Ä',
+	'\\': 'Ö',
+	']':  'Å',
+	'{':  'ä',
+	'|':  'ö',
+	'}':  'å',
+	'~':  'ß',
+}
+
+// Charsets holds the national variants of ISO 646 by name. Variants that
+// replace @ are kept as they are standardized, networks that send email
+// addresses may need a custom map.
+var Charsets = map[string]Charset{
+	"default":  DefaultCharset,
+	"us-ascii": {},
+	// ISO 646-SE, SEN 850200 B
+	"swedish": {
+		'[':  'Ä',
+		'\\': 'Ö',
+		']':  'Å',
+		'{':  'ä',
+		'|':  'ö',
+		'}':  'å',
+	},
+	// ISO 646-DE, DIN 66003
+	"german": {
+		'@':  '§',
+		'[':  'Ä',
+		'\\': 'Ö',
+		']':  'Ü',
+		'{':  'ä',
+		'|':  'ö',
+		'}':  'ü',
+		'~':  'ß',
+	},
+	// ISO 646-FR, NF Z 62-010
+	"french": {
+		'#':  '£',
+		'@':  'à',
+		'[':  '°',
+		'\\': 'ç',
+		']':  '§',
+		'`':  'µ',
+		'{':  'é',
+		'|':  'ù',
+		'}':  'è',
+		'~':  '¨',
+	},
+	// ISO 646-NO, NS 4551-1, also used in Denmark
+	"danish": {
+		'[':  'Æ',
+		'\\': 'Ø',
+		']':  'Å',
+		'{':  'æ',
+		'|':  'ø',
+		'}':  'å',
+	},
+	// ISO 646-ES
+	"spanish": {
+		'#':  '£',
+		'@':  '§',
+		'[':  '¡',
+		'\\': 'Ñ',
+		']':  '¿',
+		'{':  '°',
+		'|':  'ñ',
+		'}':  'ç',
+	},
+	// ISO 646-IT
+	"italian": {
+		'#':  '£',
+		'@':  '§',
+		'[':  '°',
+		'\\': 'ç',
+		']':  'é',
+		'`':  'ù',
+		'{':  'à',
+		'|':  'ò',
+		'}':  'è',
+		'~':  'ì',
+	},
+	// ISO 646-GB
+	"uk": {
+		'#': '£',
+		'~': '‾',
+	},
+}
+
+func init() {
+	Charsets["finnish"] = Charsets["swedish"]
+	Charsets["norwegian"] = Charsets["danish"]
+}
+
+// CharsetNames returns the names of the known charsets in order
+func CharsetNames() []string {
+	names := []string{}
+	for name := range Charsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Translate returns str with the characters substituted to utf8
+func (c Charset) Translate(str string) string {
+	return strings.Map(func(r rune) rune {
+		if s, ok := c[r]; ok {
+			return s
+		}
+		return r
+	}, str)
+}
+
+// GetCharset returns the charset known by the name, or reads it from a file if
+// there is no charset by that name.
+func GetCharset(name string) (Charset, error) {
+	if charset, ok := Charsets[strings.ToLower(name)]; ok {
+		return charset, nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset: %s, use one of %s or a file", name, strings.Join(CharsetNames(), ", "))
+	}
+	defer file.Close()
+
+	return ReadCharset(file)
+}
+
+// ReadCharset reads a charset with one substitution per line, the 7 bit
+// character followed by the character it represents, separated by space:
+//
+//	[ Æ
+//	0x23 £
+//
+// The 7 bit character can be given as a hex code, to map space or #. Empty
+// lines and lines starting with # are ignored.
+func ReadCharset(r io.Reader) (Charset, error) {
+
+	charset := Charset{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line += 1
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid charset line %d: %q", line, text)
+		}
+
+		from, err := charsetRune(fields[0])
+		if err != nil || from > 0x7F {
+			return nil, fmt.Errorf("invalid 7 bit character on charset line %d: %s", line, fields[0])
+		}
+		to, err := charsetRune(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid character on charset line %d: %s", line, fields[1])
+		}
+
+		charset[from] = to
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return charset, nil
+}
+
+// charsetRune parses a single character or a hex code such as 0x5B
+func charsetRune(field string) (rune, error) {
+	if strings.HasPrefix(field, "0x") && len(field) > 2 {
+		code, err := strconv.ParseUint(field[2:], 16, 32)
+		return rune(code), err
+	}
+
+	r, size := utf8.DecodeRuneInString(field)
+	if r == utf8.RuneError || size != len(field) {
+		return 0, fmt.Errorf("not a single character: %s", field)
+	}
+	return r, nil
+}
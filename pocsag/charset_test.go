@@ -0,0 +1,104 @@
+package pocsag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&CharsetSuite{})
+
+type CharsetSuite struct{}
+
+func (f *CharsetSuite) Test_National_Variants(c *C) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"us-ascii", "[Br]{ko}|~"},
+		{"default", "ÄBrÅäkoåöß"},
+		{"swedish", "ÄBrÅäkoåö~"},
+		{"finnish", "ÄBrÅäkoåö~"},
+		{"german", "ÄBrÜäkoüöß"},
+		{"danish", "ÆBrÅækoåø~"},
+		{"norwegian", "ÆBrÅækoåø~"},
+		{"French", "°Br§ékoèù¨"},
+	}
+
+	for _, t := range tests {
+		charset, err := GetCharset(t.name)
+		c.Assert(err, IsNil)
+		c.Assert(charset.Translate("[Br]{ko}|~"), Equals, t.expected, Commentf(t.name))
+	}
+
+	_, err := GetCharset("klingon")
+	c.Assert(err, ErrorMatches, "unknown charset: klingon, use one of .*danish.*")
+}
+
+func (f *CharsetSuite) Test_ReadCharset(c *C) {
+	charset, err := ReadCharset(strings.NewReader(`
+# Icelandic, with the @ kept for email
+[ Ð
+0x5C Þ
+0x23 £
+{ ð
+`))
+	c.Assert(err, IsNil)
+	c.Assert(charset, DeepEquals, Charset{'[': 'Ð', '\\': 'Þ', '#': '£', '{': 'ð'})
+
+	for _, t := range []struct {
+		text  string
+		error string
+	}{
+		{"[", "invalid charset line 1: \"\\[\""},
+		{"\n[ Ä Ö", "invalid charset line 2: .*"},
+		{"Ä [", "invalid 7 bit character on charset line 1: Ä"},
+		{"0x80 Ä", "invalid 7 bit character on charset line 1: 0x80"},
+		{"[ ÄÖ", "invalid character on charset line 1: ÄÖ"},
+	} {
+		_, err := ReadCharset(strings.NewReader(t.text))
+		c.Assert(err, ErrorMatches, t.error)
+	}
+}
+
+func (f *CharsetSuite) Test_Charset_File(c *C) {
+	fn := filepath.Join(c.MkDir(), "charset.txt")
+	c.Assert(os.WriteFile(fn, []byte("[ Æ\n"), 0644), IsNil)
+
+	charset, err := GetCharset(fn)
+	c.Assert(err, IsNil)
+	c.Assert(charset.Translate("[]"), Equals, "Æ]")
+}
+
+func (f *CharsetSuite) Test_Capcode_Charsets(c *C) {
+	pages := []*Page{
+		{Capcode: 1342411, Type: MessageTypeAlphanumeric, Text: "[Fire]"},
+		{Capcode: 8, Type: MessageTypeAlphanumeric, Text: "[Fire]"},
+	}
+	bits, err := NewEncoder(Options{Charset: Charsets["us-ascii"]}).Bits(pages)
+	c.Assert(err, IsNil)
+
+	options := Options{
+		Charset:         Charsets["danish"],
+		CapcodeCharsets: map[uint32]Charset{8: Charsets["us-ascii"]},
+	}
+
+	messages := ParsePOCSAG(bits, options)
+	c.Assert(len(messages), Equals, 2)
+	c.Assert(messages[0].PayloadString(MessageTypeAlphanumeric), Equals, "ÆFireÅ")
+	c.Assert(messages[1].PayloadString(MessageTypeAlphanumeric), Equals, "[Fire]")
+
+	// the encoder translates back with the charset of the capcode
+	bits, err = NewEncoder(options).Bits([]*Page{
+		{Capcode: 1342411, Type: MessageTypeAlphanumeric, Text: "ÆFireÅ"},
+		{Capcode: 8, Type: MessageTypeAlphanumeric, Text: "[Fire]"},
+	})
+	c.Assert(err, IsNil)
+
+	messages = ParsePOCSAG(bits, Options{Charset: Charsets["us-ascii"]})
+	c.Assert(len(messages), Equals, 2)
+	c.Assert(messages[0].PayloadString(MessageTypeAlphanumeric), Equals, "[Fire]")
+	c.Assert(messages[1].PayloadString(MessageTypeAlphanumeric), Equals, "[Fire]")
+}
@@ -0,0 +1,141 @@
+package pocsag
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/dhogborg/go-pocsag/internal/datatypes"
+)
+
+const (
+	// how much of the timing error at a transition that corrects the phase
+	PLL_PHASE_GAIN float64 = 0.3
+	// how much of the timing error that corrects the bit period
+	PLL_PERIOD_GAIN float64 = 0.01
+	// the bit period is not allowed to stray more than this from the nominal
+	PLL_PERIOD_LIMIT float64 = 0.05
+)
+
+// TimingStats describes how well the bit clock followed the transmission.
+// Errors are in fractions of a bit, measured at every transition between bits.
+type TimingStats struct {
+	Transitions int
+	MeanError   float64
+	MaxError    float64
+	// the recovered bit period relative to the nominal, 0.01 is 1% slower clock
+	ClockOffset float64
+}
+
+func (t TimingStats) String() string {
+	return fmt.Sprintf("%d transitions, mean error %0.1f%%, max error %0.1f%%, clock offset %0.2f%%",
+		t.Transitions, t.MeanError*100, t.MaxError*100, t.ClockOffset*100)
+}
+
+// RecoverBits slices the stream to bits with a zero-crossing locked PLL. The stream
+// should start in the center of the first bit. At every transition between bits the
+// zero crossing is compared to where the bit boundary was expected, and the sample
+// point and bit period are adjusted to stay in the center of the bits even if the
+// clock of the transmitter drifts.
+// The confidence of each bit is the magnitude of the signal at the sample point,
+// relative to the mean magnitude of the transmission. It is used for soft decoding.
+// The positions are the indexes in the stream each bit was sampled at.
+// Observe that POCSAG signifies a high bit with a low frequency.
+func RecoverBits(stream []int16, bitlength float64) ([]datatypes.Bit, []float64, []int, TimingStats) {
+
+	bits := []datatypes.Bit{}
+	confidence := []float64{}
+	positions := []int{}
+	stats := TimingStats{}
+	sumerror := 0.0
+
+	period := bitlength
+	pos := 0.0
+
+	for int(pos+0.5) < len(stream) {
+
+		a := int(pos + 0.5)
+		sample := int32(stream[a])
+		if a > 2 && a < len(stream)-2 {
+			// let the samples before and after influence our sample, to prevent spike errors
+			// summed as int32 since strong signals would overflow int16
+			sample = int32(stream[a-1]/2) + sample + int32(stream[a+1]/2)
+		}
+
+		bits = append(bits, datatypes.Bit((sample < 0)))
+		confidence = append(confidence, math.Abs(float64(sample)))
+		positions = append(positions, a)
+
+		// find the zero crossing between this bit center and the next
+		crossing := zeroCrossing(stream, a, int(pos+period+0.5))
+		if crossing >= 0 {
+
+			// the crossing should be on the boundary half a bit away
+			timingerror := crossing - (pos + period/2)
+
+			pos += PLL_PHASE_GAIN * timingerror
+			period += PLL_PERIOD_GAIN * timingerror
+
+			if period > bitlength*(1+PLL_PERIOD_LIMIT) {
+				period = bitlength * (1 + PLL_PERIOD_LIMIT)
+			} else if period < bitlength*(1-PLL_PERIOD_LIMIT) {
+				period = bitlength * (1 - PLL_PERIOD_LIMIT)
+			}
+
+			e := math.Abs(timingerror) / bitlength
+			sumerror += e
+			if e > stats.MaxError {
+				stats.MaxError = e
+			}
+			stats.Transitions += 1
+		}
+
+		pos += period
+	}
+
+	if stats.Transitions > 0 {
+		stats.MeanError = sumerror / float64(stats.Transitions)
+	}
+	stats.ClockOffset = (period / bitlength) - 1
+
+	normalize(confidence)
+
+	return bits, confidence, positions, stats
+}
+
+// normalize scales the values so that their mean is 1
+func normalize(values []float64) {
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+
+	if sum == 0 {
+		return
+	}
+
+	mean := sum / float64(len(values))
+	for i := range values {
+		values[i] /= mean
+	}
+}
+
+// zeroCrossing returns the interpolated position of the first zero crossing in
+// the stream between the from and to indexes, or -1 if the signal does not cross.
+func zeroCrossing(stream []int16, from, to int) float64 {
+
+	if to >= len(stream) {
+		to = len(stream) - 1
+	}
+
+	for a := from; a < to; a += 1 {
+		s1 := float64(stream[a])
+		s2 := float64(stream[a+1])
+
+		if (s1 > 0 && s2 <= 0) || (s1 < 0 && s2 >= 0) {
+			return float64(a) + s1/(s1-s2)
+		}
+	}
+
+	return -1
+}
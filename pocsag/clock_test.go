@@ -0,0 +1,64 @@
+package pocsag
+
+import (
+	"bytes"
+	"context"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/dhogborg/go-pocsag/internal/utils"
+)
+
+var _ = Suite(&ClockSuite{})
+
+type ClockSuite struct{}
+
+func (f *ClockSuite) Test_RecoverBits_Exact(c *C) {
+	stream := squarewave(40, 100)
+
+	bits, _, _, stats := RecoverBits(stream[20:], 40)
+
+	c.Assert(len(bits), Equals, 100)
+	for i, b := range bits {
+		c.Assert(bool(b), Equals, i%2 == 1)
+	}
+	c.Assert(stats.Transitions, Equals, 99)
+	c.Assert(stats.MaxError < 0.05, Equals, true)
+}
+
+func (f *ClockSuite) Test_RecoverBits_Clock_Drift(c *C) {
+	// the transmitter clock is 1.5% slow compared to the nominal 1200 baud
+	encoder := NewEncoder(Options{Baud: 1200, SampleRate: 48720})
+	samples, err := encoder.Samples(syncpages)
+	c.Assert(err, IsNil)
+
+	expected, err := encoder.Bits(syncpages)
+	c.Assert(err, IsNil)
+
+	// start in the center of the first bit
+	bits, _, _, stats := RecoverBits(samples[20:], 40)
+
+	c.Assert(len(bits), Equals, len(expected))
+	c.Assert(streambits(bits), Equals, streambits(expected))
+	c.Assert(stats.ClockOffset > 0.01, Equals, true)
+
+	// fixed step sampling walks off the bits
+	fixed := utils.StreamToBits(samples[20:], 40)
+	c.Assert(streambits(fixed) == streambits(expected), Equals, false)
+}
+
+func (f *ClockSuite) Test_Decoder_Clock_Drift(c *C) {
+	samples, err := NewEncoder(Options{Baud: 1200, SampleRate: 48720}).Samples(syncpages)
+	c.Assert(err, IsNil)
+
+	messages := []*Message{}
+	decoder := NewDecoder(bytes.NewReader(samplebytes(samples)), Options{SampleRate: 48000})
+	err = decoder.Decode(context.Background(), func(m *Message) {
+		messages = append(messages, m)
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(len(messages), Equals, 1)
+	c.Assert(messages[0].IsValid(), Equals, true)
+	c.Assert(messages[0].PayloadString(MessageTypeAlphanumeric), Equals, syncpages[0].Text)
+}
@@ -0,0 +1,115 @@
+package pocsag
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+var (
+	green = color.New(color.FgGreen)
+	red   = color.New(color.FgRed)
+	blue  = color.New(color.FgBlue)
+)
+
+// Options holds the configuration for a decoder instance.
+type Options struct {
+	// Samples per second in the source, default 48000. For IQ input this is the
+	// IQ samplerate, the audio samplerate is given by the decimation.
+	SampleRate int
+	// Format of the source, audio samples or one of the IQ formats. Default audio.
+	Input InputFormat
+	// Channel selection and decimation of IQ input
+	IQ IQOptions
+	// Interleaved channels in audio input, default 1. Channel selects the one to
+	// decode, counted from 0, unless AllChannels decodes every channel concurrently.
+	Channels    int
+	Channel     int
+	AllChannels bool
+	// Baudrate of the transmissions, 0 for automatic detection
+	Baud int
+	// Run a demodulator for each of the known baudrates concurrently instead of
+	// detecting the baudrate per transmission. Ignored when Baud is set.
+	Parallel bool
+	// Force message type, default auto
+	MessageType MessageType
+	// Character substitutions for alphanumeric messages, nil for DefaultCharset.
+	// CapcodeCharsets overrides the charset for the capcodes in it.
+	Charset         Charset
+	CapcodeCharsets map[uint32]Charset
+	// Bit errors accepted in the sync codeword, 0 for exact matches only, at
+	// most MAX_SYNC_ERRORS
+	SyncErrors int
+	// Force bit polarity, default auto
+	Polarity Polarity
+	// Filtering of the samples before demodulation, the zero value disables all
+	// filters. DefaultFilter suits most receivers.
+	Filter FilterOptions
+	// Folder to save the audio of every transmission to as a wav file, empty
+	// to not save any audio
+	Record string
+	// Wall clock time of the first sample in the source, messages are stamped with
+	// the time of their offset in the source. Zero stamps the messages with the
+	// time they are decoded, which suits live input.
+	StartTime time.Time
+
+	// Print debug data with the detail given by verbosity
+	Debug     bool
+	Verbosity int
+}
+
+// withDefaults returns a copy of the options with unset values filled in
+func (o Options) withDefaults() Options {
+	if o.SampleRate == 0 {
+		o.SampleRate = 48000
+	}
+	if o.Input == "" {
+		o.Input = InputFormatAudio
+	}
+	if o.Channels == 0 {
+		o.Channels = 1
+	}
+	if o.MessageType == "" {
+		o.MessageType = MessageTypeAuto
+	}
+	if o.Polarity == "" {
+		o.Polarity = PolarityAuto
+	}
+	if o.Charset == nil {
+		o.Charset = DefaultCharset
+	}
+	return o
+}
+
+// validate returns an error for options the decoder can not run with
+func (o Options) validate() error {
+	if o.Channels < 1 {
+		return fmt.Errorf("invalid number of channels: %d", o.Channels)
+	}
+	if o.Channel < 0 || o.Channel >= o.Channels {
+		return fmt.Errorf("invalid channel: %d, the input has %d channels", o.Channel, o.Channels)
+	}
+	if o.SyncErrors < 0 || o.SyncErrors > MAX_SYNC_ERRORS {
+		return fmt.Errorf("invalid number of sync errors: %d, accepted are 0 to %d", o.SyncErrors, MAX_SYNC_ERRORS)
+	}
+	switch o.Polarity {
+	case PolarityAuto, PolarityNormal, PolarityInverted:
+	default:
+		return fmt.Errorf("invalid polarity: %s", o.Polarity)
+	}
+	return nil
+}
+
+// charset returns the charset of alphanumeric messages to the capcode
+func (o Options) charset(capcode uint32) Charset {
+	if charset, ok := o.CapcodeCharsets[capcode]; ok {
+		return charset
+	}
+	return o.Charset
+}
+
+// debug returns true if debug data of the given verbosity level should be printed
+func (o Options) debug(level int) bool {
+	return o.Debug && o.Verbosity >= level
+}
@@ -0,0 +1,178 @@
+package pocsag
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Decoder reads audio samples from a source, finds transmissions and decodes
+// the POCSAG messages in them. All configuration is held by the instance, so
+// several decoders can run side by side.
+type Decoder struct {
+	options Options
+	source  io.Reader
+	readers []*StreamReader
+
+	// pipes feeding the readers when several demodulators share the source
+	inputs []*io.PipeReader
+	pipes  []*io.PipeWriter
+}
+
+// NewDecoder returns a decoder for the source provided. The source should
+// deliver signed 16 bit little endian samples at options.SampleRate, or IQ
+// samples in the format given by options.Input.
+// With options.Parallel one stream reader is created for every baudrate in
+// Bauds, each locked to its baudrate. With options.IQ.Channels, or
+// options.AllChannels for multichannel audio, one stream reader is created for
+// every channel. Each reader is fed a copy of the samples.
+func NewDecoder(source io.Reader, options Options) *Decoder {
+	options = options.withDefaults()
+
+	d := &Decoder{
+		options: options,
+		source:  source,
+	}
+
+	bauds := []int{options.Baud}
+	if options.Parallel && options.Baud == 0 {
+		bauds = Bauds
+	}
+
+	channels := []Options{options}
+	if options.Input.IsIQ() && len(options.IQ.Channels) > 0 {
+		channels = []Options{}
+		for _, offset := range options.IQ.Channels {
+			o := options
+			o.IQ.Offset = offset
+			channels = append(channels, o)
+		}
+	} else if !options.Input.IsIQ() && options.AllChannels {
+		channels = []Options{}
+		for a := 0; a < options.Channels; a += 1 {
+			o := options
+			o.Channel = a
+			channels = append(channels, o)
+		}
+	}
+
+	if len(bauds) == 1 && len(channels) == 1 {
+		d.readers = []*StreamReader{NewStreamReader(source, channels[0])}
+		return d
+	}
+
+	for _, channel := range channels {
+		for _, baud := range bauds {
+			input, pipe := io.Pipe()
+
+			o := channel
+			o.Baud = baud
+
+			d.readers = append(d.readers, NewStreamReader(input, o))
+			d.inputs = append(d.inputs, input)
+			d.pipes = append(d.pipes, pipe)
+		}
+	}
+
+	return d
+}
+
+// Decode scans the source for transmissions and calls handler with every
+// message decoded. Decode returns when the source reaches EOF, with a nil
+// error, or when the context is cancelled.
+// Messages are delivered in the order they are received by each demodulator,
+// with several demodulators the messages of different baudrates and channels
+// may come out of order. The handler is never called concurrently.
+// Invalid options are returned as an error before anything is read, a
+// transmission that can not be recorded ends the decoding with an error after
+// its messages are delivered.
+func (d *Decoder) Decode(ctx context.Context, handler func(*Message)) error {
+
+	if err := d.options.validate(); err != nil {
+		return err
+	}
+
+	if len(d.pipes) > 0 {
+		go d.distribute(ctx)
+	}
+
+	transmissions := make(chan *Transmission, 1)
+	scanerr := make(chan error, len(d.readers))
+
+	wg := sync.WaitGroup{}
+	for i, reader := range d.readers {
+		wg.Add(1)
+
+		found := make(chan *Transmission, 1)
+		go func(i int, reader *StreamReader) {
+			err := reader.StartScan(ctx, found)
+			// stop the distribution to this reader
+			if len(d.inputs) > 0 {
+				d.inputs[i].Close()
+			}
+			scanerr <- err
+		}(i, reader)
+
+		go func() {
+			defer wg.Done()
+			for transmission := range found {
+				transmissions <- transmission
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(transmissions)
+	}()
+
+	for transmission := range transmissions {
+		for _, m := range ParseTransmission(transmission, d.options) {
+			handler(m)
+		}
+	}
+
+	var err error
+	for range d.readers {
+		if e := <-scanerr; e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// distribute copies the source to the pipe of every stream reader in chunks of
+// whole samples. A reader that has stopped is skipped, the source is no longer
+// read once every reader has stopped or the context is cancelled.
+func (d *Decoder) distribute(ctx context.Context) {
+
+	buffer := make([]byte, 8192*d.options.Channels)
+
+	for {
+		c, err := io.ReadFull(d.source, buffer)
+
+		stopped := 0
+		if c > 0 {
+			for _, pipe := range d.pipes {
+				if _, e := pipe.Write(buffer[:c]); e != nil {
+					stopped += 1
+				}
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		if err == nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+
+		if err != nil || c < len(buffer) || stopped == len(d.pipes) {
+			for _, pipe := range d.pipes {
+				pipe.CloseWithError(err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package pocsag
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+	. "gopkg.in/check.v1"
+
+	"github.com/dhogborg/go-pocsag/internal/utils"
+)
+
+var _ = Suite(&DecoderSuite{})
+
+type DecoderSuite struct{}
+
+// mixedBauds returns a 512 baud transmission directly followed by a 1200 baud
+// transmission, without any noise in between to end the first.
+func mixedBauds(c *C) []byte {
+	slow, err := NewEncoder(Options{Baud: 512}).Samples(testpages[:1])
+	c.Assert(err, IsNil)
+	fast, err := NewEncoder(Options{Baud: 1200}).Samples(testpages[1:])
+	c.Assert(err, IsNil)
+
+	return samplebytes(append(slow, fast...))
+}
+
+func (f *DecoderSuite) Test_Parallel_Mixed_Bauds(c *C) {
+	messages := map[uint32]*Message{}
+	decoder := NewDecoder(bytes.NewReader(mixedBauds(c)), Options{Parallel: true})
+	err := decoder.Decode(context.Background(), func(m *Message) {
+		messages[m.Capcode] = m
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(len(messages), Equals, 3)
+	c.Assert(messages[1342411].Baud, Equals, 512)
+	c.Assert(messages[8].Baud, Equals, 1200)
+	c.Assert(messages[1234567].Baud, Equals, 1200)
+}
+
+func (f *DecoderSuite) Test_Parallel_Auto_Misses_Second(c *C) {
+	// the auto detection commits to 512 baud for the whole signal
+	messages := []*Message{}
+	decoder := NewDecoder(bytes.NewReader(mixedBauds(c)), Options{})
+	err := decoder.Decode(context.Background(), func(m *Message) {
+		messages = append(messages, m)
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(len(messages), Equals, 1)
+	c.Assert(messages[0].Baud, Equals, 512)
+}
+
+func (f *DecoderSuite) Test_Parallel_Cancel(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	decoder := NewDecoder(bytes.NewReader(mixedBauds(c)), Options{Parallel: true})
+	err := decoder.Decode(ctx, func(m *Message) {})
+	c.Assert(err, Equals, context.Canceled)
+}
+
+// endless delivers silence forever and counts the reads
+type endless struct {
+	reads int64
+}
+
+func (e *endless) Read(p []byte) (int, error) {
+	atomic.AddInt64(&e.reads, 1)
+	for a := range p {
+		p[a] = 0
+	}
+	return len(p), nil
+}
+
+func (f *DecoderSuite) Test_Parallel_Cancel_Stops_Reading(c *C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	source := &endless{}
+	decoder := NewDecoder(source, Options{Parallel: true})
+	err := decoder.Decode(ctx, func(m *Message) {})
+	c.Assert(err, Equals, context.DeadlineExceeded)
+
+	// a read in progress when Decode returns may complete
+	reads := atomic.LoadInt64(&source.reads)
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(atomic.LoadInt64(&source.reads) <= reads+1, Equals, true)
+}
+
+func (f *DecoderSuite) Test_Soft_Decoding(c *C) {
+	samples, err := NewEncoder(Options{}).Samples(testpages)
+	c.Assert(err, IsNil)
+
+	// three faded bits of the wrong sign in the first message codeword,
+	// after the preamble, the sync codeword and 7 codewords
+	bitlength := 40
+	for _, b := range []int{3, 10, 20} {
+		start := (POCSAG_PREAMBLE_LEN + 32 + 7*32 + b) * bitlength
+		for a := start; a < start+bitlength; a += 1 {
+			samples[a] = -samples[a] / 8
+		}
+	}
+
+	decode := func(soft bool) []*Message {
+		messages := []*Message{}
+		reader := NewStreamReader(bytes.NewReader(samplebytes(samples)), Options{})
+
+		transmissions := make(chan *Transmission, 1)
+		go reader.StartScan(context.Background(), transmissions)
+
+		for t := range transmissions {
+			if !soft {
+				t.Confidence = nil
+			}
+			messages = append(messages, ParseTransmission(t, Options{})...)
+		}
+		return messages
+	}
+
+	messages := decode(false)
+	c.Assert(messages[0].IsValid(), Equals, false)
+
+	messages = decode(true)
+	assertTestpages(c, messages)
+	c.Assert(messages[0].SoftDecoded(), Equals, 1)
+	c.Assert(messages[1].SoftDecoded(), Equals, 0)
+}
+
+// stereo returns the first test page on the left channel and the other pages
+// on the right channel, the shorter channel is padded with noise
+func stereo(c *C) []byte {
+	left, err := NewEncoder(Options{}).Samples(testpages[:1])
+	c.Assert(err, IsNil)
+	right, err := NewEncoder(Options{}).Samples(testpages[1:])
+	c.Assert(err, IsNil)
+
+	samples := make([]int16, 0, 2*len(left))
+	for a := 0; a < len(left) || a < len(right); a += 1 {
+		l, r := int16(4000*(a%2*2-1)), int16(4000*(a%2*2-1))
+		if a < len(left) {
+			l = left[a]
+		}
+		if a < len(right) {
+			r = right[a]
+		}
+		samples = append(samples, l, r)
+	}
+	return samplebytes(samples)
+}
+
+func (f *DecoderSuite) Test_Decoder_Channel_Selection(c *C) {
+	decode := func(channel int) []uint32 {
+		capcodes := []uint32{}
+		decoder := NewDecoder(bytes.NewReader(stereo(c)), Options{Channels: 2, Channel: channel})
+		err := decoder.Decode(context.Background(), func(m *Message) {
+			c.Assert(m.Channel, Equals, channel+1)
+			capcodes = append(capcodes, m.Capcode)
+		})
+		c.Assert(err, IsNil)
+		return capcodes
+	}
+
+	c.Assert(decode(0), DeepEquals, []uint32{1342411})
+	c.Assert(decode(1), DeepEquals, []uint32{8, 1234567})
+}
+
+func (f *DecoderSuite) Test_Decoder_All_Channels(c *C) {
+	channels := map[uint32]int{}
+	decoder := NewDecoder(bytes.NewReader(stereo(c)), Options{Channels: 2, AllChannels: true})
+	err := decoder.Decode(context.Background(), func(m *Message) {
+		channels[m.Capcode] = m.Channel
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(channels, DeepEquals, map[uint32]int{1342411: 1, 8: 2, 1234567: 2})
+}
+
+func (f *DecoderSuite) Test_Decoder_Record(c *C) {
+	pages, err := NewEncoder(Options{}).Samples(testpages)
+	c.Assert(err, IsNil)
+
+	// noise before the transmission, random so the recording can be found in it
+	random := rand.New(rand.NewSource(1))
+	samples := make([]int16, 20000, 20000+len(pages))
+	for a := range samples {
+		samples[a] = int16(random.Intn(8000) - 4000)
+	}
+	samples = append(samples, pages...)
+
+	folder := c.MkDir()
+	messages := []*Message{}
+	decoder := NewDecoder(bytes.NewReader(samplebytes(samples)), Options{Record: folder})
+	err = decoder.Decode(context.Background(), func(m *Message) {
+		messages = append(messages, m)
+	})
+	c.Assert(err, IsNil)
+	assertTestpages(c, messages)
+
+	recording := messages[0].Recording
+	c.Assert(filepath.Dir(recording), Equals, folder)
+	c.Assert(messages[2].Recording, Equals, recording)
+
+	reader, err := OpenWav(recording)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	c.Assert(reader.SampleRate, Equals, uint32(48000))
+
+	data, err := io.ReadAll(reader)
+	c.Assert(err, IsNil)
+
+	// the recording is the unfiltered input from before the preamble to the end
+	start := bytes.Index(samplebytes(samples), data[:200])
+	c.Assert(start >= 0 && start/2 < 20000, Equals, true)
+	c.Assert(data, DeepEquals, samplebytes(samples[start/2:]))
+
+	// and decodes to the same messages
+	messages = []*Message{}
+	decoder = NewDecoder(bytes.NewReader(data), Options{})
+	err = decoder.Decode(context.Background(), func(m *Message) {
+		messages = append(messages, m)
+	})
+	c.Assert(err, IsNil)
+	assertTestpages(c, messages)
+}
+
+func (f *DecoderSuite) Test_Decoder_Record_Error(c *C) {
+	pages, err := NewEncoder(Options{}).Samples(testpages)
+	c.Assert(err, IsNil)
+
+	messages := []*Message{}
+	folder := filepath.Join(c.MkDir(), "missing")
+	decoder := NewDecoder(bytes.NewReader(samplebytes(pages)), Options{Record: folder})
+	err = decoder.Decode(context.Background(), func(m *Message) {
+		messages = append(messages, m)
+	})
+	c.Assert(err, ErrorMatches, "error saving transmission: .*")
+
+	c.Assert(len(messages), Equals, len(testpages))
+	c.Assert(messages[0].Recording, Equals, "")
+}
+
+func (f *DecoderSuite) Test_Decoder_Timestamps(c *C) {
+	pages, err := NewEncoder(Options{}).Samples(testpages)
+	c.Assert(err, IsNil)
+
+	// a second of noise before the transmission
+	samples := make([]int16, 48000, 48000+len(pages))
+	for a := range samples {
+		samples[a] = int16(4000 * (a%2*2 - 1))
+	}
+	samples = append(samples, pages...)
+
+	start := time.Date(2024, 3, 1, 22, 15, 0, 0, time.UTC)
+	messages := []*Message{}
+	decoder := NewDecoder(bytes.NewReader(samplebytes(samples)), Options{StartTime: start})
+	err = decoder.Decode(context.Background(), func(m *Message) {
+		messages = append(messages, m)
+	})
+	c.Assert(err, IsNil)
+	assertTestpages(c, messages)
+
+	// the first address codeword is in frame 3, after the preamble and the sync
+	expected := utils.SampleTime(48000+int64(POCSAG_PREAMBLE_LEN+32+6*32)*40, 48000)
+	c.Assert(messages[0].Offset-expected < 50*time.Microsecond, Equals, true)
+	c.Assert(expected-messages[0].Offset < 50*time.Microsecond, Equals, true)
+
+	for _, m := range messages {
+		c.Assert(m.Timestamp, Equals, start.Add(m.Offset))
+	}
+	c.Assert(messages[1].Offset > messages[0].Offset, Equals, true)
+
+	// many batches from a transmitter with a 1.5% slow clock, the offsets follow
+	// the recovered clock rather than the nominal bitlength
+	drifted := []*Page{}
+	for a := 0; a < 30; a += 1 {
+		drifted = append(drifted, &Page{Capcode: uint32(1000 + a*3), Type: MessageTypeAlphanumeric, Text: fmt.Sprintf("Page %d", a)})
+	}
+
+	encoder := NewEncoder(Options{Baud: 1200, SampleRate: 48720})
+	pages, err = encoder.Samples(drifted)
+	c.Assert(err, IsNil)
+
+	// bit index of the address codeword of every page
+	batches, err := encoder.Codewords(drifted)
+	c.Assert(err, IsNil)
+	addresses := []int{}
+	for b, batch := range batches {
+		for w, word := range batch {
+			if word != POCSAG_IDLE && word&0x80000000 == 0 {
+				addresses = append(addresses, POCSAG_PREAMBLE_LEN+b*(POCSAG_BATCH_LEN+32)+32+w*32)
+			}
+		}
+	}
+	c.Assert(len(addresses), Equals, len(drifted))
+
+	messages = []*Message{}
+	decoder = NewDecoder(bytes.NewReader(samplebytes(append(samples[:48000], pages...))), Options{StartTime: start})
+	err = decoder.Decode(context.Background(), func(m *Message) {
+		messages = append(messages, m)
+	})
+	c.Assert(err, IsNil)
+	c.Assert(len(messages), Equals, len(drifted))
+
+	for i, m := range messages {
+		c.Assert(m.Text(), Equals, drifted[i].Text)
+
+		// 40.6 samples per bit at 48000 Hz
+		expected := utils.SampleTime(48000+int64(float64(addresses[i])*40.6), 48000)
+		c.Assert(m.Offset-expected < 50*time.Microsecond, Equals, true, Commentf("message %d is %s off", i, m.Offset-expected))
+		c.Assert(expected-m.Offset < 50*time.Microsecond, Equals, true, Commentf("message %d is %s off", i, m.Offset-expected))
+	}
+}
+
+func (f *DecoderSuite) Test_Decoder_Invalid_Options(c *C) {
+	for _, t := range []struct {
+		options Options
+		error   string
+	}{
+		{Options{Channels: 2, Channel: 2}, "invalid channel: 2, the input has 2 channels"},
+		{Options{Channels: 2, Channel: -1, AllChannels: true}, "invalid channel: -1, .*"},
+		{Options{Channels: -2}, "invalid number of channels: -2"},
+		{Options{Polarity: "foo"}, "invalid polarity: foo"},
+		{Options{SyncErrors: -1}, "invalid number of sync errors: -1, .*"},
+		{Options{SyncErrors: 8}, "invalid number of sync errors: 8, accepted are 0 to 4"},
+	} {
+		decoder := NewDecoder(bytes.NewReader(stereo(c)), t.options)
+		err := decoder.Decode(context.Background(), func(m *Message) {})
+		c.Assert(err, ErrorMatches, t.error)
+
+		transmissions := make(chan *Transmission)
+		err = NewStreamReader(bytes.NewReader(stereo(c)), t.options).StartScan(context.Background(), transmissions)
+		c.Assert(err, ErrorMatches, t.error)
+	}
+}
+
+func (f *DecoderSuite) Test_Decoder_Quiet(c *C) {
+	// the library only prints when debugging
+	output := &bytes.Buffer{}
+	color.Output = output
+	defer func() { color.Output = os.Stdout }()
+
+	samples, err := NewEncoder(Options{}).Samples(testpages)
+	c.Assert(err, IsNil)
+
+	messages := []*Message{}
+	decoder := NewDecoder(bytes.NewReader(samplebytes(samples)), Options{})
+	err = decoder.Decode(context.Background(), func(m *Message) {
+		messages = append(messages, m)
+	})
+	c.Assert(err, IsNil)
+	assertTestpages(c, messages)
+	c.Assert(output.String(), Equals, "")
+}
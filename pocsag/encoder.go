@@ -0,0 +1,317 @@
+package pocsag
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dhogborg/go-pocsag/internal/datatypes"
+	"github.com/dhogborg/go-pocsag/internal/utils"
+	"github.com/dhogborg/go-pocsag/internal/wav"
+)
+
+const (
+	// number of 1010 bits sent before the first batch
+	POCSAG_PREAMBLE_LEN int = 576
+
+	// amplitude of the generated audio
+	ENCODER_AMPLITUDE int16 = 16000
+)
+
+// Page is a message to be encoded. Type is one of MessageTypeAlphanumeric,
+// MessageTypeBitcodedDecimal or MessageTypeToneOnly.
+type Page struct {
+	Capcode  uint32
+	Function uint8
+	Type     MessageType
+	Text     string
+}
+
+// Encoder builds POCSAG transmissions from pages, the reverse of the decoder.
+type Encoder struct {
+	options Options
+}
+
+// NewEncoder returns an encoder using the baud, samplerate and charset from
+// the options. Baud 0 encodes at 1200 baud.
+func NewEncoder(options Options) *Encoder {
+	options = options.withDefaults()
+	if options.Baud == 0 {
+		options.Baud = 1200
+	}
+
+	return &Encoder{
+		options: options,
+	}
+}
+
+// Codewords places the pages in batches of 16 codewords. Each address codeword is
+// placed in the frame given by the 3 lowest bits of the capcode, positions not used
+// by a page are filled with idle codewords.
+func (e *Encoder) Codewords(pages []*Page) ([][]uint32, error) {
+
+	batches := [][]uint32{}
+	batch := []uint32{}
+
+	add := func(word uint32) {
+		batch = append(batch, word)
+		if len(batch) == 16 {
+			batches = append(batches, batch)
+			batch = []uint32{}
+		}
+	}
+
+	for _, page := range pages {
+
+		if page.Capcode > 0x1FFFFF {
+			return nil, fmt.Errorf("capcode out of range: %d", page.Capcode)
+		}
+		if page.Function > 3 {
+			return nil, fmt.Errorf("function out of range: %d", page.Function)
+		}
+
+		message, err := e.messageCodewords(page)
+		if err != nil {
+			return nil, err
+		}
+
+		// wait for the frame of the address
+		frame := int(page.Capcode & 7)
+		for len(batch)/2 != frame {
+			add(POCSAG_IDLE)
+		}
+
+		add(EncodeAddress(page.Capcode, page.Function))
+		for _, word := range message {
+			add(word)
+		}
+	}
+
+	for len(batch) > 0 {
+		add(POCSAG_IDLE)
+	}
+
+	return batches, nil
+}
+
+// Bits returns the complete transmission as bits, the preamble followed
+// by the batches each starting with the sync codeword.
+func (e *Encoder) Bits(pages []*Page) ([]datatypes.Bit, error) {
+
+	batches, err := e.Codewords(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := make([]datatypes.Bit, POCSAG_PREAMBLE_LEN)
+	for a := range bits {
+		bits[a] = datatypes.Bit(a%2 == 0)
+	}
+
+	for _, batch := range batches {
+		bits = append(bits, utils.Uint32ToBits(POCSAG_PREAMBLE)...)
+		for _, word := range batch {
+			bits = append(bits, utils.Uint32ToBits(word)...)
+		}
+	}
+
+	return bits, nil
+}
+
+// Samples renders the transmission as audio at the baud and samplerate of
+// the encoder. A high bit is a negative sample, as read by StreamToBits.
+func (e *Encoder) Samples(pages []*Page) ([]int16, error) {
+
+	bits, err := e.Bits(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	bitlength := float64(e.options.SampleRate) / float64(e.options.Baud)
+	samples := make([]int16, int(float64(len(bits))*bitlength))
+
+	for a := range samples {
+		if bits[int(float64(a)/bitlength)] {
+			samples[a] = -ENCODER_AMPLITUDE
+		} else {
+			samples[a] = ENCODER_AMPLITUDE
+		}
+	}
+
+	return samples, nil
+}
+
+// WriteWav writes the transmission as a wav file
+func (e *Encoder) WriteWav(w io.Writer, pages []*Page) error {
+
+	samples, err := e.Samples(pages)
+	if err != nil {
+		return err
+	}
+
+	return wav.Write(w, uint32(e.options.SampleRate), samples)
+}
+
+// WriteRaw writes the transmission as signed 16 bit little endian samples,
+// the format read from stdin by the decoder.
+func (e *Encoder) WriteRaw(w io.Writer, pages []*Page) error {
+
+	samples, err := e.Samples(pages)
+	if err != nil {
+		return err
+	}
+
+	buffer := bufio.NewWriter(w)
+	if err := binary.Write(buffer, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	return buffer.Flush()
+}
+
+// messageCodewords encodes the text of the page to message codewords
+func (e *Encoder) messageCodewords(page *Page) ([]uint32, error) {
+
+	switch page.Type {
+	case MessageTypeToneOnly:
+		return []uint32{}, nil
+	case MessageTypeBitcodedDecimal:
+		return EncodeNumeric(page.Text)
+	case MessageTypeAlphanumeric:
+		return EncodeAlpha(page.Text, e.options.charset(page.Capcode))
+	default:
+		return nil, fmt.Errorf("invalid message type for encoding: %s", page.Type)
+	}
+}
+
+// EncodeAddress returns an address codeword for the 18 high bits of the capcode
+// and the function bits. The 3 low bits of the capcode are given by the frame.
+func EncodeAddress(capcode uint32, function uint8) uint32 {
+	data := ((capcode >> 3) << 2) | uint32(function&3)
+	return encodeCodeword(data)
+}
+
+// EncodeAlpha returns message codewords for the text as 7 bit characters
+// in LSB to MSB order. Characters in the charset are translated back to
+// their 7 bit representation. Characters outside of ASCII, and the ASCII
+// characters the charset replaces, are an error.
+func EncodeAlpha(text string, charset Charset) ([]uint32, error) {
+
+	reverse := map[rune]rune{}
+	for b, s := range charset {
+		reverse[s] = b
+	}
+
+	bits := []datatypes.Bit{}
+	for _, r := range text {
+		if b, ok := reverse[r]; ok {
+			r = b
+		} else if _, replaced := charset[r]; replaced || r > 0x7F {
+			return nil, fmt.Errorf("character not in charset: %q", r)
+		}
+		for a := uint(0); a < 7; a += 1 {
+			bits = append(bits, datatypes.Bit((r>>a)&1 == 1))
+		}
+	}
+
+	return messageCodewords(bits, false), nil
+}
+
+// EncodeNumeric returns message codewords for the text as bitcoded decimals
+// in LSB to MSB order. The last codeword is padded with spaces.
+func EncodeNumeric(text string) ([]uint32, error) {
+
+	bits := []datatypes.Bit{}
+	for _, r := range text {
+		digit, err := bcdDigit(r)
+		if err != nil {
+			return nil, err
+		}
+		for a := uint(0); a < 4; a += 1 {
+			bits = append(bits, datatypes.Bit((digit>>a)&1 == 1))
+		}
+	}
+
+	return messageCodewords(bits, true), nil
+}
+
+// messageCodewords splits the bits in 20 bit message codewords. The last
+// codeword is padded with zeros, or with bcd spaces if numeric is set.
+func messageCodewords(bits []datatypes.Bit, numeric bool) []uint32 {
+
+	words := []uint32{}
+
+	for a := 0; a < len(bits); a += 20 {
+
+		data := uint32(1) // message flag
+		for b := a; b < a+20; b += 1 {
+
+			var bit datatypes.Bit
+			if b < len(bits) {
+				bit = bits[b]
+			} else if numeric {
+				// 0xC, space, LSB first
+				bit = datatypes.Bit((b-a)%4 >= 2)
+			}
+
+			data = (data << 1) | uint32(bit.Int())
+		}
+
+		words = append(words, encodeCodeword(data))
+	}
+
+	return words
+}
+
+// bcdDigit returns the 4 bit value of a numeric character, the reverse of utils.BitcodedDecimals
+func bcdDigit(r rune) (uint8, error) {
+
+	if r >= '0' && r <= '9' {
+		return uint8(r - '0'), nil
+	}
+
+	switch r {
+	case 'U':
+		return 11, nil
+	case ' ':
+		return 12, nil
+	case '-':
+		return 13, nil
+	case ')':
+		return 14, nil
+	case '(':
+		return 15, nil
+	}
+
+	return 0, fmt.Errorf("invalid numeric character: %q", r)
+}
+
+// encodeCodeword takes the 21 data bits of a codeword, the flag bit and 20 bits of
+// payload, and appends the 10 BCH(31,21) parity bits and the even parity bit.
+func encodeCodeword(data uint32) uint32 {
+
+	// the remainder of the data divided by the generator polynomial
+	// gives the parity bits, the reverse of what syndrome() checks
+	codeword := data << (BCH_N - BCH_K)
+	coeff := uint32(BHC_COEFF) >> 1
+	mask := uint32(1 << (BCH_N - 1))
+
+	remainder := codeword
+	for a := 0; a < BCH_K; a += 1 {
+		if (remainder & mask) > 0 {
+			remainder = remainder ^ coeff
+		}
+		mask >>= 1
+		coeff >>= 1
+	}
+
+	codeword = (codeword | remainder) << 1
+
+	// even parity over all 31 bits
+	ones := 0
+	for a := codeword; a > 0; a >>= 1 {
+		ones += int(a & 1)
+	}
+
+	return codeword | uint32(ones%2)
+}
@@ -0,0 +1,150 @@
+package pocsag
+
+import (
+	"bytes"
+	"context"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/dhogborg/go-pocsag/internal/utils"
+)
+
+var _ = Suite(&EncoderSuite{})
+
+type EncoderSuite struct{}
+
+var testpages = []*Page{
+	{Capcode: 1342411, Function: 3, Type: MessageTypeAlphanumeric, Text: "Fire in building 4, Östra gate"},
+	{Capcode: 8, Function: 0, Type: MessageTypeBitcodedDecimal, Text: "0707-193385"},
+	{Capcode: 1234567, Function: 1, Type: MessageTypeToneOnly},
+}
+
+func (f *EncoderSuite) Test_EncodeAddress(c *C) {
+	c.Assert(EncodeAddress(1342411, 3), Equals, uint32(0x51EF3DC2))
+}
+
+func (f *EncoderSuite) Test_EncodeCodeword_Valid(c *C) {
+	for _, data := range []uint32{0, 1, 0x1FFFFF, 0x12345, 0x100000} {
+		bits := utils.Uint32ToBits(encodeCodeword(data))
+
+		c.Assert(syndrome(bits), Equals, uint32(0))
+		c.Assert(utils.ParityCheck(bits[:31], bits[31]), Equals, true)
+	}
+}
+
+func (f *EncoderSuite) Test_Codewords_Frame_Placement(c *C) {
+	e := NewEncoder(Options{})
+
+	batches, err := e.Codewords([]*Page{{Capcode: 13, Type: MessageTypeToneOnly}})
+	c.Assert(err, IsNil)
+	c.Assert(len(batches), Equals, 1)
+
+	// frame 5
+	for i, word := range batches[0] {
+		if i == 10 {
+			c.Assert(word, Equals, EncodeAddress(13, 0))
+		} else {
+			c.Assert(word, Equals, POCSAG_IDLE)
+		}
+	}
+}
+
+func (f *EncoderSuite) Test_Codewords_Invalid(c *C) {
+	e := NewEncoder(Options{})
+
+	_, err := e.Codewords([]*Page{{Capcode: 0x200000, Type: MessageTypeToneOnly}})
+	c.Assert(err, NotNil)
+
+	_, err = e.Codewords([]*Page{{Capcode: 8, Type: MessageTypeBitcodedDecimal, Text: "12A"}})
+	c.Assert(err, NotNil)
+
+	_, err = e.Codewords([]*Page{{Capcode: 8, Function: 5, Type: MessageTypeToneOnly}})
+	c.Assert(err, ErrorMatches, "function out of range: 5")
+
+	// characters outside of ASCII must be in the charset
+	_, err = NewEncoder(Options{Charset: Charsets["us-ascii"]}).Codewords([]*Page{{Capcode: 8, Type: MessageTypeAlphanumeric, Text: "café €"}})
+	c.Assert(err, ErrorMatches, "character not in charset: 'é'")
+
+	// the charset decodes [ and ] as Ä and Å, they can not be sent as themselves
+	_, err = NewEncoder(Options{}).Codewords([]*Page{{Capcode: 8, Type: MessageTypeAlphanumeric, Text: "a[b]"}})
+	c.Assert(err, ErrorMatches, "character not in charset: '\\['")
+
+	_, err = NewEncoder(Options{Charset: Charsets["french"]}).Codewords([]*Page{{Capcode: 8, Type: MessageTypeAlphanumeric, Text: "café"}})
+	c.Assert(err, IsNil)
+}
+
+func (f *EncoderSuite) Test_Bits_Roundtrip(c *C) {
+	e := NewEncoder(Options{})
+
+	bits, err := e.Bits(testpages)
+	c.Assert(err, IsNil)
+
+	messages := ParsePOCSAG(bits, Options{})
+	assertTestpages(c, messages)
+}
+
+func (f *EncoderSuite) Test_Samples_Roundtrip(c *C) {
+	for _, rate := range [][]int{{512, 22050}, {512, 44100}, {512, 48000}, {1200, 48000}, {2400, 44100}} {
+		options := Options{Baud: rate[0], SampleRate: rate[1]}
+
+		buffer := &bytes.Buffer{}
+		err := NewEncoder(options).WriteRaw(buffer, testpages)
+		c.Assert(err, IsNil)
+
+		for _, filter := range []FilterOptions{{}, DefaultFilter} {
+			messages := []*Message{}
+			decoder := NewDecoder(bytes.NewReader(buffer.Bytes()), Options{SampleRate: rate[1], Filter: filter})
+			err = decoder.Decode(context.Background(), func(m *Message) {
+				messages = append(messages, m)
+			})
+			c.Assert(err, IsNil)
+
+			assertTestpages(c, messages)
+			c.Assert(messages[0].Baud, Equals, rate[0])
+		}
+	}
+}
+
+func (f *EncoderSuite) Test_Samples_Inverted_Roundtrip(c *C) {
+	samples, err := NewEncoder(Options{}).Samples(testpages)
+	c.Assert(err, IsNil)
+
+	for i := range samples {
+		samples[i] = -samples[i]
+	}
+
+	messages := []*Message{}
+	decoder := NewDecoder(bytes.NewReader(samplebytes(samples)), Options{})
+	err = decoder.Decode(context.Background(), func(m *Message) {
+		messages = append(messages, m)
+	})
+	c.Assert(err, IsNil)
+
+	assertTestpages(c, messages)
+	c.Assert(messages[0].Polarity, Equals, PolarityInverted)
+}
+
+func (f *EncoderSuite) Test_WriteWav(c *C) {
+	buffer := &bytes.Buffer{}
+	err := NewEncoder(Options{SampleRate: 22050}).WriteWav(buffer, testpages)
+	c.Assert(err, IsNil)
+
+	header := buffer.Bytes()[:44]
+	c.Assert(string(header[0:4]), Equals, "RIFF")
+	c.Assert(string(header[8:12]), Equals, "WAVE")
+	c.Assert(string(header[36:40]), Equals, "data")
+	c.Assert(int(header[24])|int(header[25])<<8, Equals, 22050)
+}
+
+func assertTestpages(c *C, messages []*Message) {
+	c.Assert(len(messages), Equals, len(testpages))
+
+	for i, page := range testpages {
+		m := messages[i]
+		c.Assert(m.Capcode, Equals, page.Capcode)
+		c.Assert(m.Function, Equals, page.Function)
+		c.Assert(m.IsValid(), Equals, true)
+
+		c.Assert(m.PayloadString(page.Type), Equals, page.Text)
+	}
+}
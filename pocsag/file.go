@@ -0,0 +1,14 @@
+package pocsag
+
+import (
+	"github.com/dhogborg/go-pocsag/internal/wav"
+)
+
+// OpenWav opens a wav file for the scanner to read as a standard transmission.
+// Only the header is read, the samples are streamed from disk and converted
+// to 16 bits as they are read. The samplerate, channels and duration are
+// available from the reader. Channels are interleaved, set options.Channels
+// to the channels of the file to select one of them.
+func OpenWav(path string) (*wav.Reader, error) {
+	return wav.Open(path)
+}
@@ -0,0 +1,169 @@
+package pocsag
+
+import (
+	"math"
+
+	"github.com/dhogborg/go-pocsag/internal/utils"
+)
+
+// FilterOptions configures the filter chain applied to the samples before
+// transmissions are detected and bits are sliced. A zero value disables the stage.
+type FilterOptions struct {
+	// pole of the DC blocker, closer to 1 gives a lower cutoff. A high cutoff
+	// bends the long runs of equal bits and moves the zero crossings.
+	DCBlock float64
+	// cutoff of the low-pass filter as a fraction of the baudrate
+	LowPass float64
+	// amplitude the automatic gain control aims for
+	AGC float64
+}
+
+// DefaultFilter is a filter chain that suits most receivers
+var DefaultFilter = FilterOptions{
+	DCBlock: 0.9995,
+	LowPass: 0.75,
+	AGC:     8000,
+}
+
+const (
+	// how fast the AGC follows a stronger and a weaker signal, per sample
+	AGC_ATTACK float64 = 0.01
+	AGC_DECAY  float64 = 0.0005
+)
+
+// Filter runs the samples through a DC blocker, a low-pass FIR filter and an
+// automatic gain control. The state is kept between calls so that a stream can
+// be filtered in chunks.
+type Filter struct {
+	options FilterOptions
+
+	// DC blocker state
+	x1 float64
+	y1 float64
+
+	// FIR coefficients and the most recent input samples
+	taps    []float64
+	history []float64
+
+	// envelope followed by the AGC
+	level float64
+}
+
+// NewFilter returns a filter chain for the samplerate. The low-pass filter is matched
+// to the baudrate, with baud 0 it is matched to the highest known baudrate.
+func NewFilter(options FilterOptions, samplerate int, baud int) *Filter {
+
+	if baud == 0 {
+		for _, b := range Bauds {
+			if b > baud {
+				baud = b
+			}
+		}
+	}
+
+	f := &Filter{
+		options: options,
+	}
+
+	if options.LowPass > 0 {
+		cutoff := options.LowPass * float64(baud) / float64(samplerate)
+		// about two bits long
+		length := int(2*float64(samplerate)/float64(baud)) | 1
+		f.taps = lowpassTaps(cutoff, length)
+		f.history = make([]float64, length)
+	}
+
+	return f
+}
+
+// Process filters a chunk of samples. The DC blocked samples are returned along with
+// the output of the full chain, since the low-pass filter removes the high frequency
+// noise that is used to tell noise from signal.
+func (f *Filter) Process(stream []int16) (dcblocked []int16, filtered []int16) {
+
+	dcblocked = make([]int16, len(stream))
+	filtered = make([]int16, len(stream))
+
+	for i, sample := range stream {
+
+		x := float64(sample)
+
+		// y[n] = x[n] - x[n-1] + p * y[n-1]
+		if f.options.DCBlock > 0 {
+			y := x - f.x1 + f.options.DCBlock*f.y1
+			f.x1 = x
+			f.y1 = y
+			x = y
+		}
+		dcblocked[i] = utils.Clip(x)
+
+		if f.taps != nil {
+			copy(f.history, f.history[1:])
+			f.history[len(f.history)-1] = x
+
+			sum := 0.0
+			for t, coeff := range f.taps {
+				sum += coeff * f.history[t]
+			}
+			x = sum
+		}
+
+		if f.options.AGC > 0 {
+			amplitude := math.Abs(x)
+			if amplitude > f.level {
+				f.level += AGC_ATTACK * (amplitude - f.level)
+			} else {
+				f.level += AGC_DECAY * (amplitude - f.level)
+			}
+
+			if f.level > 1 {
+				x = x * f.options.AGC / f.level
+			}
+		}
+
+		filtered[i] = utils.Clip(x)
+	}
+
+	return dcblocked, filtered
+}
+
+// Flush returns the samples still delayed in the low-pass filter at the end
+// of the stream.
+func (f *Filter) Flush() (dcblocked []int16, filtered []int16) {
+	return f.Process(make([]int16, len(f.history)/2))
+}
+
+// Delay returns the number of samples the output is delayed by the low-pass filter
+func (f *Filter) Delay() int {
+	return len(f.history) / 2
+}
+
+// lowpassTaps returns the coefficients of a windowed sinc low-pass filter with the
+// cutoff given as a fraction of the samplerate. The gain is 1 at 0 Hz.
+func lowpassTaps(cutoff float64, length int) []float64 {
+
+	taps := make([]float64, length)
+	center := float64(length-1) / 2
+	sum := 0.0
+
+	for t := range taps {
+		n := float64(t) - center
+
+		sinc := 2 * cutoff
+		if n != 0 {
+			sinc = math.Sin(2*math.Pi*cutoff*n) / (math.Pi * n)
+		}
+
+		// hamming window
+		window := 0.54 - 0.46*math.Cos(2*math.Pi*float64(t)/float64(length-1))
+
+		taps[t] = sinc * window
+		sum += taps[t]
+	}
+
+	for t := range taps {
+		taps[t] /= sum
+	}
+
+	return taps
+}
@@ -0,0 +1,82 @@
+package pocsag
+
+import (
+	"bytes"
+	"context"
+	"math"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&FilterSuite{})
+
+type FilterSuite struct{}
+
+func (f *FilterSuite) Test_DCBlock(c *C) {
+	filter := NewFilter(FilterOptions{DCBlock: 0.995}, 48000, 1200)
+
+	stream := make([]int16, 4800)
+	for i := range stream {
+		stream[i] = 5000
+	}
+
+	dcblocked, filtered := filter.Process(stream)
+	c.Assert(dcblocked[0], Equals, int16(5000))
+	c.Assert(dcblocked[len(dcblocked)-1], Equals, int16(0))
+	c.Assert(filtered, DeepEquals, dcblocked)
+}
+
+func (f *FilterSuite) Test_LowPass(c *C) {
+	// 200 Hz passes, 6000 Hz is stopped
+	c.Assert(toneLevel(200) > 0.9, Equals, true)
+	c.Assert(toneLevel(6000) < 0.05, Equals, true)
+}
+
+func (f *FilterSuite) Test_AGC(c *C) {
+	filter := NewFilter(FilterOptions{AGC: 8000}, 48000, 1200)
+
+	_, filtered := filter.Process(squarewave(40, 200))
+	level := math.Abs(float64(filtered[len(filtered)-1]))
+	c.Assert(math.Abs(level-8000) < 400, Equals, true)
+}
+
+func (f *FilterSuite) Test_Decoder_DC_Offset(c *C) {
+	samples, err := NewEncoder(Options{}).Samples(testpages)
+	c.Assert(err, IsNil)
+
+	// the signal never crosses zero
+	for i := range samples {
+		samples[i] = samples[i]/4 + 6000
+	}
+
+	decode := func(filter FilterOptions) []*Message {
+		messages := []*Message{}
+		decoder := NewDecoder(bytes.NewReader(samplebytes(samples)), Options{Filter: filter})
+		err := decoder.Decode(context.Background(), func(m *Message) {
+			messages = append(messages, m)
+		})
+		c.Assert(err, IsNil)
+		return messages
+	}
+
+	c.Assert(len(decode(FilterOptions{})), Equals, 0)
+	assertTestpages(c, decode(DefaultFilter))
+}
+
+// toneLevel returns the amplitude of a tone after the low-pass filter, relative to the input
+func toneLevel(frequency float64) float64 {
+	filter := NewFilter(FilterOptions{LowPass: 0.75}, 48000, 1200)
+
+	stream := make([]int16, 4800)
+	for i := range stream {
+		stream[i] = int16(10000 * math.Sin(2*math.Pi*frequency*float64(i)/48000))
+	}
+
+	_, filtered := filter.Process(stream)
+
+	peak := 0.0
+	for _, sample := range filtered[len(filtered)/2:] {
+		peak = math.Max(peak, math.Abs(float64(sample)))
+	}
+	return peak / 10000
+}
@@ -0,0 +1,150 @@
+package pocsag
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/dhogborg/go-pocsag/internal/utils"
+)
+
+const (
+	// the audio samplerate the IQ input is decimated to when no factor is given
+	IQ_AUDIO_RATE int = 24000
+	// cutoff of the channel filter as a fraction of the audio samplerate
+	IQ_CHANNEL_CUTOFF float64 = 0.4
+)
+
+// IQOptions configures the channel selection and FM demodulation of complex IQ input.
+type IQOptions struct {
+	// frequency of the channel relative to the center of the IQ input, in Hz
+	Offset float64
+	// offsets of several channels to decode concurrently, replaces Offset
+	Channels []float64
+	// frequency the IQ input is centered on in Hz, if known. Messages are tagged
+	// with the channel frequency, Center plus the offset of the channel.
+	Center float64
+	// factor the IQ samplerate is divided by before FM demodulation, 0 picks
+	// the factor that gives an audio samplerate closest above IQ_AUDIO_RATE
+	Decimation int
+}
+
+// IQDemodulator turns interleaved IQ samples to audio. The channel at the offset is
+// mixed down to 0 Hz, low-pass filtered and decimated, then FM demodulated by the
+// phase difference between consecutive samples. The state is kept between calls so
+// that the input can be processed in chunks.
+type IQDemodulator struct {
+	format     InputFormat
+	samplerate int
+	decimation int
+
+	// oscillator moving the channel to 0 Hz
+	phase float64
+	step  float64
+
+	// channel filter coefficients and the most recent mixed samples
+	taps    []float64
+	history []complex128
+	count   int
+
+	// last filtered sample, for the discriminator
+	previous complex128
+	// bytes of a sample split between two chunks
+	pending []byte
+}
+
+// NewIQDemodulator returns a demodulator for IQ samples in the format given, at
+// samplerate IQ samples per second.
+func NewIQDemodulator(format InputFormat, samplerate int, options IQOptions) *IQDemodulator {
+
+	decimation := options.Decimation
+	if decimation <= 0 {
+		decimation = samplerate / IQ_AUDIO_RATE
+	}
+	if decimation < 1 {
+		decimation = 1
+	}
+
+	length := 8*decimation + 1
+
+	return &IQDemodulator{
+		format:     format,
+		samplerate: samplerate,
+		decimation: decimation,
+		step:       -2 * math.Pi * options.Offset / float64(samplerate),
+		taps:       lowpassTaps(IQ_CHANNEL_CUTOFF/float64(decimation), length),
+		history:    make([]complex128, length),
+	}
+}
+
+// SampleRate returns the samplerate of the demodulated audio
+func (d *IQDemodulator) SampleRate() int {
+	return int(float64(d.samplerate)/float64(d.decimation) + 0.5)
+}
+
+// Process demodulates a chunk of IQ bytes to audio samples. A positive frequency
+// deviation gives a positive sample, as with rtl_fm.
+func (d *IQDemodulator) Process(data []byte) []int16 {
+
+	size := d.format.sampleSize()
+
+	data = append(d.pending, data...)
+	n := len(data) / size
+	d.pending = append([]byte{}, data[n*size:]...)
+
+	audio := make([]int16, 0, n/d.decimation+1)
+
+	for i := 0; i < n; i += 1 {
+
+		// mix the channel down to 0 Hz
+		sample := d.sample(data[i*size:]) * complex(math.Cos(d.phase), math.Sin(d.phase))
+		d.phase = math.Remainder(d.phase+d.step, 2*math.Pi)
+
+		d.history = append(d.history, sample)
+
+		d.count += 1
+		if d.count < d.decimation {
+			continue
+		}
+		d.count = 0
+
+		// the channel filter is only needed for the samples kept
+		window := d.history[len(d.history)-len(d.taps):]
+		filtered := complex128(0)
+		for t, coeff := range d.taps {
+			filtered += window[t] * complex(coeff, 0)
+		}
+
+		audio = append(audio, d.discriminate(filtered))
+	}
+
+	// keep what the filter needs for the next chunk
+	d.history = append(d.history[:0], d.history[len(d.history)-len(d.taps):]...)
+
+	return audio
+}
+
+// discriminate returns the phase change since the previous sample, scaled so
+// that half the samplerate is full scale
+func (d *IQDemodulator) discriminate(sample complex128) int16 {
+	delta := sample * complex(real(d.previous), -imag(d.previous))
+	d.previous = sample
+
+	return utils.Clip(math.Atan2(imag(delta), real(delta)) / math.Pi * math.MaxInt16)
+}
+
+// sample reads one IQ sample from the start of b, scaled to the range -1 to 1
+func (d *IQDemodulator) sample(b []byte) complex128 {
+
+	switch d.format {
+	case InputFormatIQU8:
+		return complex((float64(b[0])-127.5)/127.5, (float64(b[1])-127.5)/127.5)
+	case InputFormatIQS16:
+		i := int16(binary.LittleEndian.Uint16(b))
+		q := int16(binary.LittleEndian.Uint16(b[2:]))
+		return complex(float64(i)/32768, float64(q)/32768)
+	default:
+		i := math.Float32frombits(binary.LittleEndian.Uint32(b))
+		q := math.Float32frombits(binary.LittleEndian.Uint32(b[4:]))
+		return complex(float64(i), float64(q))
+	}
+}
@@ -0,0 +1,170 @@
+package pocsag
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&IQSuite{})
+
+type IQSuite struct{}
+
+func (f *IQSuite) Test_Decimation_Auto(c *C) {
+	c.Assert(NewIQDemodulator(InputFormatIQU8, 240000, IQOptions{}).SampleRate(), Equals, 24000)
+	c.Assert(NewIQDemodulator(InputFormatIQU8, 1024000, IQOptions{}).SampleRate(), Equals, 24381)
+	c.Assert(NewIQDemodulator(InputFormatIQU8, 22050, IQOptions{}).SampleRate(), Equals, 22050)
+	c.Assert(NewIQDemodulator(InputFormatIQU8, 240000, IQOptions{Decimation: 5}).SampleRate(), Equals, 48000)
+}
+
+func (f *IQSuite) Test_Discriminator_Tone(c *C) {
+	frequencies := make([]float64, 40)
+	for a := range frequencies {
+		frequencies[a] = 3000
+	}
+
+	// +3 kHz at 24 kHz is an eighth of a turn per sample
+	d := NewIQDemodulator(InputFormatIQF32, 24000, IQOptions{})
+	audio := d.Process(fmModulate(frequencies, 24000, 24000, 0, InputFormatIQF32))
+
+	c.Assert(len(audio), Equals, 40)
+	// after the channel filter has settled
+	for _, sample := range audio[10:] {
+		c.Assert(math.Abs(float64(sample)-math.MaxInt16/4) < 50, Equals, true)
+	}
+}
+
+func (f *IQSuite) Test_Process_Split_Samples(c *C) {
+	data := fmModulate([]float64{-3000, -3000, -3000, -3000}, 24000, 24000, 0, InputFormatIQS16)
+
+	d := NewIQDemodulator(InputFormatIQS16, 24000, IQOptions{})
+	audio := d.Process(data[:5])
+	audio = append(audio, d.Process(data[5:])...)
+
+	c.Assert(len(audio), Equals, 4)
+	c.Assert(audio[3] < 0, Equals, true)
+}
+
+func (f *IQSuite) Test_Decoder_IQ_Roundtrip(c *C) {
+	// the channel is 25 kHz above the center of the recording
+	frequencies := pageFrequencies(c, testpages, 25000)
+
+	for _, format := range []InputFormat{InputFormatIQU8, InputFormatIQS16, InputFormatIQF32} {
+		data := fmModulate(frequencies, 1200, 240000, 0.3, format)
+
+		messages := []*Message{}
+		options := Options{SampleRate: 240000, Input: format, IQ: IQOptions{Offset: 25000}, Filter: DefaultFilter}
+		decoder := NewDecoder(bytes.NewReader(data), options)
+		err := decoder.Decode(context.Background(), func(m *Message) {
+			messages = append(messages, m)
+		})
+		c.Assert(err, IsNil)
+
+		assertTestpages(c, messages)
+		c.Assert(messages[0].Baud, Equals, 1200)
+		c.Assert(messages[0].Frequency, Equals, 25000.0)
+	}
+}
+
+func (f *IQSuite) Test_Decoder_Channels(c *C) {
+	low := fmSignal(pageFrequencies(c, testpages[:1], -100000), 1200, 480000, 0)
+	high := fmSignal(pageFrequencies(c, testpages[1:], 120000), 1200, 480000, 1)
+
+	// two carriers at half amplitude, the shorter transmission ends in an idle carrier
+	samples := make([]complex128, len(low))
+	if len(high) > len(samples) {
+		samples = make([]complex128, len(high))
+	}
+	for a := range samples {
+		if a < len(low) {
+			samples[a] += low[a] / 2
+		} else {
+			samples[a] += complex(0.5, 0)
+		}
+		if a < len(high) {
+			samples[a] += high[a] / 2
+		} else {
+			samples[a] += complex(0, 0.5)
+		}
+	}
+
+	options := Options{
+		SampleRate: 480000,
+		Input:      InputFormatIQS16,
+		IQ:         IQOptions{Channels: []float64{-100000, 120000}, Center: 169650000},
+		Filter:     DefaultFilter,
+	}
+
+	messages := map[uint32]*Message{}
+	decoder := NewDecoder(bytes.NewReader(iqBytes(samples, InputFormatIQS16)), options)
+	err := decoder.Decode(context.Background(), func(m *Message) {
+		messages[m.Capcode] = m
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(len(messages), Equals, 3)
+	c.Assert(messages[1342411].Frequency, Equals, 169550000.0)
+	c.Assert(messages[8].Frequency, Equals, 169770000.0)
+	c.Assert(messages[1234567].Frequency, Equals, 169770000.0)
+	c.Assert(messages[8].FrequencyString(), Equals, "169.77000 MHz")
+}
+
+// fmModulate returns IQ samples of a carrier following the frequencies, each held
+// for one symbol at the baudrate, starting at the phase given in radians
+func fmModulate(frequencies []float64, baud int, samplerate int, phase float64, format InputFormat) []byte {
+	return iqBytes(fmSignal(frequencies, baud, samplerate, phase), format)
+}
+
+// fmSignal returns the complex samples of a carrier following the frequencies
+func fmSignal(frequencies []float64, baud int, samplerate int, phase float64) []complex128 {
+
+	symbollength := float64(samplerate) / float64(baud)
+	samples := make([]complex128, int(float64(len(frequencies))*symbollength))
+
+	for a := range samples {
+		phase += 2 * math.Pi * frequencies[int(float64(a)/symbollength)] / float64(samplerate)
+		samples[a] = complex(math.Cos(phase), math.Sin(phase))
+	}
+
+	return samples
+}
+
+// iqBytes converts complex samples in the range -1 to 1 to the IQ format
+func iqBytes(samples []complex128, format InputFormat) []byte {
+
+	buffer := &bytes.Buffer{}
+	for _, sample := range samples {
+		i, q := real(sample), imag(sample)
+
+		switch format {
+		case InputFormatIQU8:
+			buffer.Write([]byte{byte(127.5 + i*127), byte(127.5 + q*127)})
+		case InputFormatIQS16:
+			binary.Write(buffer, binary.LittleEndian, []int16{int16(i * 32000), int16(q * 32000)})
+		case InputFormatIQF32:
+			binary.Write(buffer, binary.LittleEndian, []float32{float32(i), float32(q)})
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+// pageFrequencies returns the frequency of every bit of the pages encoded at 1200
+// baud, for a channel at the offset
+func pageFrequencies(c *C, pages []*Page, offset float64) []float64 {
+	bits, err := NewEncoder(Options{}).Bits(pages)
+	c.Assert(err, IsNil)
+
+	frequencies := make([]float64, len(bits))
+	for a, bit := range bits {
+		if bit {
+			frequencies[a] = offset - 4500
+		} else {
+			frequencies[a] = offset + 4500
+		}
+	}
+	return frequencies
+}
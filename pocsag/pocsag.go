@@ -0,0 +1,1208 @@
+package pocsag
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	mathbits "math/bits"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dhogborg/go-pocsag/internal/datatypes"
+	"github.com/dhogborg/go-pocsag/internal/utils"
+
+	"github.com/fatih/color"
+)
+
+const (
+	POCSAG_PREAMBLE     uint32 = 0x7CD215D8
+	POCSAG_IDLE         uint32 = 0x7A89C197
+	POCSAG_BATCH_LEN    int    = 512
+	POCSAG_CODEWORD_LEN int    = 32
+)
+
+// most bit errors accepted in the sync codeword, above this random and idle
+// codewords start to match
+const MAX_SYNC_ERRORS int = 4
+
+// time of messages in text output, to the millisecond
+const TIME_FORMAT = "2006-01-02 15:04:05.000"
+
+const (
+	// number of least reliable bits flipped in every combination by the soft decoder
+	CHASE_BITS int = 4
+	// highest summed confidence of the bits flipped by the soft decoder, 1 is
+	// the confidence of an average bit
+	SOFT_MAX_DISTANCE float64 = 2.0
+)
+
+type CodewordType string
+
+const (
+	CodewordTypeAddress CodewordType = "ADDRESS"
+	CodewordTypeMessage CodewordType = "MESSAGE"
+	CodewordTypeIdle    CodewordType = "IDLE"
+)
+
+type MessageType string
+
+const (
+	MessageTypeAuto            MessageType = "auto"
+	MessageTypeAlphanumeric    MessageType = "alpha"
+	MessageTypeBitcodedDecimal MessageType = "bcd"
+	MessageTypeToneOnly        MessageType = "tone"
+)
+
+// Polarity of the bits sliced from the audio. Depending on receiver and
+// sideband the audio can be inverted, which inverts every bit.
+type Polarity string
+
+const (
+	PolarityAuto     Polarity = "auto"
+	PolarityNormal   Polarity = "normal"
+	PolarityInverted Polarity = "inverted"
+)
+
+// ParsePOCSAG takes bits decoded from the stream and parses them for
+// batches of codewords then compiles them into messages using the options provided.
+// The bits are inverted first if the polarity is detected or forced to be inverted.
+func ParsePOCSAG(bits []datatypes.Bit, options Options) []*Message {
+	return ParseSoftPOCSAG(bits, nil, options)
+}
+
+// ParseSoftPOCSAG is ParsePOCSAG with the confidence of every bit, as given by
+// RecoverBits. Codewords that can not be corrected by the parity bits alone are
+// soft decoded. A nil confidence disables soft decoding.
+func ParseSoftPOCSAG(bits []datatypes.Bit, confidence []float64, options Options) []*Message {
+
+	pocsag := NewPOCSAG(options)
+
+	polarity := pocsag.Polarity(bits)
+	if polarity == PolarityInverted {
+		bits = invertBits(bits)
+	}
+
+	if options.debug(0) {
+		blue.Println("Polarity:", polarity)
+	}
+
+	batches, err := pocsag.ParseSoftBatches(bits, confidence)
+	if err != nil {
+		if options.debug(0) {
+			println(err.Error())
+		}
+		return []*Message{}
+	}
+
+	if options.debug(2) {
+		for i, batch := range batches {
+			println("")
+			println("Batch: ", i)
+			batch.Print()
+		}
+	}
+
+	messages := pocsag.ParseMessages(batches)
+	for _, m := range messages {
+		m.Polarity = polarity
+	}
+
+	return messages
+}
+
+// ParseTransmission parses the bits of a transmission for messages and tags
+// the messages with the baudrate, channel frequency, audio channel and recording
+// of the transmission. The offset of each message in the stream is given by the
+// offset of the transmission and the sample position of the address codeword, and
+// the message is stamped with the time of the offset if options.StartTime is set.
+func ParseTransmission(transmission *Transmission, options Options) []*Message {
+
+	messages := ParseSoftPOCSAG(transmission.Bits, transmission.Confidence, options)
+	for _, m := range messages {
+		m.Baud = transmission.Baud
+		m.Frequency = transmission.Frequency
+		m.Channel = transmission.Channel
+		m.Recording = transmission.Recording
+
+		if transmission.SampleRate > 0 {
+			var sample int64
+			if m.Bit < len(transmission.Positions) {
+				sample = transmission.Offset + int64(transmission.Positions[m.Bit])
+			} else {
+				bitlength := float64(transmission.SampleRate) / float64(transmission.Baud)
+				sample = transmission.Offset + int64(float64(m.Bit)*bitlength+0.5)
+			}
+			m.Offset = utils.SampleTime(sample, transmission.SampleRate)
+
+			if !options.StartTime.IsZero() {
+				m.Timestamp = options.StartTime.Add(m.Offset)
+			}
+		}
+	}
+
+	return messages
+}
+
+type POCSAG struct {
+	options Options
+}
+
+// NewPOCSAG returns a parser using the options provided
+func NewPOCSAG(options Options) *POCSAG {
+	return &POCSAG{
+		options: options.withDefaults(),
+	}
+}
+
+// Polarity returns the polarity forced by the options, or detects it by counting
+// the sync and idle codewords found in the bits, normal and inverted.
+func (p *POCSAG) Polarity(bits []datatypes.Bit) Polarity {
+
+	if p.options.Polarity != PolarityAuto {
+		return p.options.Polarity
+	}
+
+	normal := 0
+	inverted := 0
+
+	for a := 0; a < len(bits)-32; a += 1 {
+
+		word := utils.PackBits(bits[a : a+32])
+
+		for _, known := range []uint32{POCSAG_PREAMBLE, POCSAG_IDLE} {
+			if mathbits.OnesCount32(word^known) <= p.options.SyncErrors {
+				normal += 1
+			}
+			if mathbits.OnesCount32(^word^known) <= p.options.SyncErrors {
+				inverted += 1
+			}
+		}
+	}
+
+	if inverted > normal {
+		return PolarityInverted
+	}
+
+	return PolarityNormal
+}
+
+// ParseBatches takes bits decoded from the stream and parses them for
+// batches of codewords.
+// The sync codeword is accepted with up to options.SyncErrors bit errors. With
+// automatic polarity it is also accepted inverted, in which case the batch bits
+// are inverted as well.
+// Once synchronized the next sync codeword is expected right after the batch. If it
+// is missed the batch is still parsed from the timing of the previous one, and kept
+// if most of its codewords are valid.
+func (p *POCSAG) ParseBatches(bits []datatypes.Bit) ([]*Batch, error) {
+	return p.ParseSoftBatches(bits, nil)
+}
+
+// ParseSoftBatches is ParseBatches with the confidence of every bit for soft
+// decoding of the codewords, nil disables soft decoding.
+func (p *POCSAG) ParseSoftBatches(bits []datatypes.Bit, confidence []float64) ([]*Batch, error) {
+
+	batches := []*Batch{}
+
+	var start = -1
+	var batchno = -1
+
+	// where the next sync codeword is expected, -1 if not synchronized
+	var expected = -1
+	var inverted = false
+
+	// synchornize with the decoded bits
+	for a := 0; a < len(bits)-32; {
+
+		word := utils.PackBits(bits[a : a+32])
+
+		sync, inv := p.isSync(word)
+		bridged := !sync && a == expected
+
+		if !sync && !bridged {
+			a += 1
+			continue
+		}
+
+		if sync {
+			inverted = inv
+		}
+
+		end := a + 32 + POCSAG_BATCH_LEN
+		if end > len(bits) {
+			end = len(bits)
+		}
+
+		batchbits := bits[a+32 : end]
+		var batchconfidence []float64
+		if confidence != nil {
+			batchconfidence = confidence[a+32 : end]
+		}
+
+		// the transmission ended before the batch did, the codewords received
+		// after a sync codeword are kept
+		if len(batchbits) < POCSAG_BATCH_LEN {
+			if bridged || len(batchbits) < POCSAG_CODEWORD_LEN {
+				break
+			}
+			batchbits, batchconfidence = padBatch(batchbits, batchconfidence, inverted)
+		}
+
+		batch := &Batch{}
+		batch.parse(batchbits, batchconfidence, inverted)
+
+		// the timing of the previous batch did not hold up
+		if bridged && !batch.mostlyValid() {
+			expected = -1
+			a += 1
+			continue
+		}
+
+		batch.Inverted = inverted
+		batch.Bridged = bridged
+		batch.Start = a + 32
+
+		batchno += 1
+		start = a + 32
+
+		// for file output as bin data
+		// can be read back with InputFormatBinary
+		if p.options.debug(3) {
+			stream := utils.MSBBitsToBytes(bits[a:end], 8)
+
+			if err := os.MkdirAll("batches", 0755); err != nil {
+				return nil, err
+			}
+			out, err := os.Create(fmt.Sprintf("batches/batch-%d.bin", batchno))
+			if err != nil {
+				return nil, err
+			}
+			out.Write(stream)
+			out.Close()
+		}
+
+		batches = append(batches, batch)
+
+		expected = a + 32 + POCSAG_BATCH_LEN
+		a = expected
+	}
+
+	if start < 0 {
+		return nil, fmt.Errorf("could not obtain message sync")
+	}
+
+	return batches, nil
+
+}
+
+// padBatch fills up a truncated batch with idle codewords, inverted if the batch
+// is. A partial codeword at the end is replaced as well.
+func padBatch(bits []datatypes.Bit, confidence []float64, inverted bool) ([]datatypes.Bit, []float64) {
+
+	idle := POCSAG_IDLE
+	if inverted {
+		idle = ^idle
+	}
+
+	whole := len(bits) - len(bits)%POCSAG_CODEWORD_LEN
+	padded := append([]datatypes.Bit{}, bits[:whole]...)
+	for len(padded) < POCSAG_BATCH_LEN {
+		padded = append(padded, utils.Uint32ToBits(idle)...)
+	}
+
+	if confidence == nil {
+		return padded, nil
+	}
+
+	padconfidence := append([]float64{}, confidence[:whole]...)
+	for len(padconfidence) < POCSAG_BATCH_LEN {
+		padconfidence = append(padconfidence, 1)
+	}
+	return padded, padconfidence
+}
+
+// isSync matches a word to the sync codeword, accepting options.SyncErrors bit errors.
+// Inverted is set if the word matches the inverted sync codeword.
+func (p *POCSAG) isSync(word uint32) (sync bool, inverted bool) {
+
+	if mathbits.OnesCount32(word^POCSAG_PREAMBLE) <= p.options.SyncErrors {
+		return true, false
+	}
+
+	if p.options.Polarity == PolarityAuto && mathbits.OnesCount32(^word^POCSAG_PREAMBLE) <= p.options.SyncErrors {
+		return true, true
+	}
+
+	return false, false
+}
+
+// ParseMessages takes a bundle of codeword from a series of batches and
+// compiles them into messages.
+// A message starts with an address codeword and a bunch of message codewords follows
+// until either the batch ends or an idle codeword appears.
+// An address codeword without any message codewords is a tone only message.
+func (p *POCSAG) ParseMessages(batches []*Batch) []*Message {
+
+	messages := []*Message{}
+
+	var message *Message
+	for _, b := range batches {
+
+		for i := range b.Codewords {
+			codeword := &b.Codewords[i]
+
+			switch codeword.Type {
+			// append current and begin new message
+			case CodewordTypeAddress:
+				if message != nil {
+					messages = append(messages, message)
+				}
+				message = NewMessage(codeword)
+				message.Bit = b.Start + i*32
+				message.options = p.options
+
+			// append current but dont start new
+			case CodewordTypeIdle:
+				if message != nil {
+					messages = append(messages, message)
+				}
+				message = nil
+
+			case CodewordTypeMessage:
+				if message != nil {
+					message.AddPayload(codeword)
+				} else if p.options.debug(0) {
+					red.Println("Message codeword without sync!")
+				}
+
+			default:
+				if p.options.debug(0) {
+					red.Println("Unknown codeword encounterd")
+				}
+			}
+		}
+	}
+
+	if message != nil {
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+// Message construct holds refernces to codewords.
+// The Payload is a seies of codewords of message type.
+// Capcode is the full 21 bit address of the reciptient and Function
+// the 2 function bits from the address codeword.
+// Baud and Frequency are set when the message is parsed from a transmission,
+// Frequency only for IQ input and Channel only for multichannel audio, counted
+// from 1. Polarity is the polarity of the transmission the message was found in,
+// and Recording the wav file it was saved to, if recorded.
+// Bit is the index of the address codeword in the bits parsed, and Offset the
+// time into the stream the address codeword was received at. Timestamp is the
+// wall clock time of the offset, or the time of decoding without a start time.
+type Message struct {
+	Timestamp  time.Time
+	Reciptient *Codeword
+	Payload    []*Codeword
+	Capcode    uint32
+	Function   uint8
+	Baud       int
+	Frequency  float64
+	Channel    int
+	Polarity   Polarity
+	Recording  string
+	Bit        int
+	Offset     time.Duration
+
+	// options of the parser that created the message
+	options Options
+}
+
+// NewMessage creates a new message construct ready to accept payload codewords
+func NewMessage(reciptient *Codeword) *Message {
+	return &Message{
+		Timestamp:  time.Now(),
+		Reciptient: reciptient,
+		Payload:    []*Codeword{},
+		Capcode:    reciptient.Capcode(),
+		Function:   reciptient.Function(),
+		Polarity:   PolarityNormal,
+		options:    Options{}.withDefaults(),
+	}
+}
+
+func (m *Message) Print(messagetype MessageType) {
+	green.Println("-- Message --------------")
+	green.Println("Time:       ", m.Timestamp.Format(TIME_FORMAT))
+	green.Println("Reciptient: ", m.ReciptientString())
+	green.Println("Function:   ", m.Function)
+
+	if m.Frequency != 0 {
+		green.Println("Frequency:  ", m.FrequencyString())
+	}
+
+	if m.Channel != 0 {
+		green.Println("Channel:    ", m.Channel)
+	}
+
+	if m.Polarity == PolarityInverted {
+		green.Println("Polarity:   ", m.Polarity)
+	}
+
+	if m.Recording != "" {
+		green.Println("Recording:  ", m.Recording)
+	}
+
+	if !m.IsValid() {
+		red.Println("This message has parity check errors. Contents might be corrupted")
+	}
+
+	if m.options.debug(0) && m.biterrors() > 0 {
+		red.Println(m.biterrors(), "bits corrected by parity check")
+	}
+
+	if m.options.debug(0) && m.SoftDecoded() > 0 {
+		red.Println(m.SoftDecoded(), "codewords rescued by soft decoding")
+	}
+
+	if m.IsToneOnly() {
+		green.Println("Tone only")
+		println("")
+		return
+	}
+
+	println("")
+	print(m.PayloadString(messagetype))
+	println("")
+	println("")
+
+}
+
+func (m *Message) Write(path string, messagetype MessageType) {
+	if !os.IsPathSeparator(path[len(path)-1]) {
+		path += "/"
+	}
+
+	timestr := m.Timestamp.Format("20060102_15.04.05")
+	file, err := os.Create(path + m.ReciptientString() + "_" + timestr + ".txt")
+	defer file.Close()
+
+	if err != nil {
+		println("error creating file: " + err.Error())
+		return
+	}
+
+	file.WriteString("Time: " + m.Timestamp.Format(TIME_FORMAT) + "\n")
+	if m.Offset != 0 {
+		file.WriteString("Offset: " + m.Offset.String() + "\n")
+	}
+	file.WriteString("Reciptient: " + m.ReciptientString() + "\n")
+	file.WriteString(fmt.Sprintf("Function: %d\n", m.Function))
+	if m.Frequency != 0 {
+		file.WriteString("Frequency: " + m.FrequencyString() + "\n")
+	}
+	if m.Channel != 0 {
+		file.WriteString(fmt.Sprintf("Channel: %d\n", m.Channel))
+	}
+	if m.Recording != "" {
+		file.WriteString("Recording: " + m.Recording + "\n")
+	}
+	file.WriteString("-------------------\n")
+	file.WriteString(m.PayloadString(messagetype) + "\n")
+
+}
+
+// jsonMessage is the structure of a message in JSON output
+type jsonMessage struct {
+	Timestamp      time.Time   `json:"timestamp"`
+	Offset         float64     `json:"offset,omitempty"`
+	Capcode        uint32      `json:"capcode"`
+	Function       uint8       `json:"function"`
+	Baud           int         `json:"baud"`
+	Frequency      float64     `json:"frequency,omitempty"`
+	Channel        int         `json:"channel,omitempty"`
+	Polarity       Polarity    `json:"polarity"`
+	Recording      string      `json:"recording,omitempty"`
+	Type           MessageType `json:"type"`
+	Text           string      `json:"text"`
+	Numeric        string      `json:"numeric"`
+	BitCorrections int         `json:"bit_corrections"`
+	SoftDecoded    int         `json:"soft_decoded"`
+	Valid          bool        `json:"valid"`
+	Codewords      []string    `json:"codewords"`
+}
+
+// JSON returns the message as a single line JSON object. The text and
+// numeric fields holds the payload decoded as alphanumeric and bcd, the
+// type field tells which one was decided on using messagetype.
+func (m *Message) JSON(messagetype MessageType) ([]byte, error) {
+
+	codewords := []string{m.Reciptient.Hex()}
+	for _, c := range m.Payload {
+		codewords = append(codewords, c.Hex())
+	}
+
+	return json.Marshal(&jsonMessage{
+		Timestamp:      m.Timestamp,
+		Offset:         m.Offset.Seconds(),
+		Capcode:        m.Capcode,
+		Function:       m.Function,
+		Baud:           m.Baud,
+		Frequency:      m.Frequency,
+		Channel:        m.Channel,
+		Polarity:       m.Polarity,
+		Recording:      m.Recording,
+		Type:           m.Type(messagetype),
+		Text:           m.alphaString(),
+		Numeric:        m.bcdString(),
+		BitCorrections: m.biterrors(),
+		SoftDecoded:    m.SoftDecoded(),
+		Valid:          m.IsValid(),
+		Codewords:      codewords,
+	})
+}
+
+// AddPayload codeword to a message. Must be codeword of CodewordTypeMessage type
+// to make sense.
+func (m *Message) AddPayload(codeword *Codeword) {
+	m.Payload = append(m.Payload, codeword)
+}
+
+// ReciptientString returns the reciptient capcode as a decimal number.
+func (m *Message) ReciptientString() string {
+	return fmt.Sprintf("%d", m.Capcode)
+}
+
+// FrequencyString returns the channel frequency in MHz, or in kHz for an
+// offset from the center of the IQ input
+func (m *Message) FrequencyString() string {
+	if math.Abs(m.Frequency) < 1e6 {
+		return fmt.Sprintf("%+0.3f kHz", m.Frequency/1e3)
+	}
+	return fmt.Sprintf("%0.5f MHz", m.Frequency/1e6)
+}
+
+// IsValid returns true if no parity bit check errors occurs in the message payload
+// or the reciptient address.
+func (m *Message) IsValid() bool {
+
+	if !m.Reciptient.ValidParity {
+		return false
+	}
+
+	for _, c := range m.Payload {
+		if !c.ValidParity {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Message) biterrors() (errors int) {
+	errors = m.Reciptient.BitCorrections
+	for _, c := range m.Payload {
+		errors += c.BitCorrections
+	}
+	return
+}
+
+// SoftDecoded returns the number of codewords in the message that were
+// rescued by soft decoding
+func (m *Message) SoftDecoded() (count int) {
+	if m.Reciptient.SoftDecoded {
+		count += 1
+	}
+	for _, c := range m.Payload {
+		if c.SoftDecoded {
+			count += 1
+		}
+	}
+	return
+}
+
+// IsToneOnly returns true if the message has no payload, only the address
+// and function bits are sent.
+func (m *Message) IsToneOnly() bool {
+	return len(m.Payload) == 0
+}
+
+// Type returns the type of the message. Tone only messages are always
+// MessageTypeToneOnly, otherwise messagetype is returned unless it's Auto,
+// in which case the type is estimated from the payload.
+func (m *Message) Type(messagetype MessageType) MessageType {
+
+	if m.IsToneOnly() {
+		return MessageTypeToneOnly
+	}
+
+	if messagetype != MessageTypeAuto {
+		return messagetype
+	}
+
+	return m.estimateMessageType(m.alphaString(), m.bcdString())
+}
+
+// Text returns the payload decoded with the message type from the options
+// of the parser that created the message.
+func (m *Message) Text() string {
+	return m.PayloadString(m.options.MessageType)
+}
+
+// PayloadString can try to decide to print the message as bitcoded decimal ("bcd") or
+// as an alphanumeric string. There is not always a clear indication which is correct,
+// so we can force either type by setting messagetype to something other than Auto.
+// Tone only messages have an empty payload string.
+func (m *Message) PayloadString(messagetype MessageType) string {
+
+	switch m.Type(messagetype) {
+	case MessageTypeToneOnly:
+		return ""
+	case MessageTypeBitcodedDecimal:
+		return m.bcdString()
+	default:
+		return m.alphaString()
+	}
+
+}
+
+// AlphaPayloadString takes bits in LSB to MSB order and decodes them as
+// 7 bit bytes that will become ASCII text.
+// Characters outside of ASCII can occur, so we substitude them using the charset
+// of the capcode. The zero bits filling up the last codeword are dropped.
+func (m *Message) AlphaPayloadString(bits []datatypes.Bit) string {
+
+	str := strings.TrimRight(string(utils.LSBBitsToBytes(bits, 7)), "\x00")
+
+	return m.options.charset(m.Capcode).Translate(str)
+}
+
+// alphaString decodes the payload as 7 bit characters, the same as
+// AlphaPayloadString without unpacking the codewords to bits
+func (m *Message) alphaString() string {
+	chars := make([]byte, 0, len(m.Payload)*20/7)
+	m.payloadValues(7, func(value uint8) {
+		chars = append(chars, value)
+	})
+	return m.options.charset(m.Capcode).Translate(strings.TrimRight(string(chars), "\x00"))
+}
+
+// bcdString decodes the payload as bitcoded decimals, the same as
+// utils.BitcodedDecimals without unpacking the codewords to bits
+func (m *Message) bcdString() string {
+	digits := strings.Builder{}
+	m.payloadValues(4, func(value uint8) {
+		digits.WriteString(utils.BcdChar(value))
+	})
+	return strings.TrimRight(digits.String(), " ")
+}
+
+// payloadValues calls fn with the payload bits of the message codewords in values of
+// size bits, taking the bits in LSB to MSB order. Bits at the end not filling a value
+// are dropped.
+func (m *Message) payloadValues(size uint, fn func(value uint8)) {
+
+	var value uint8
+	var n uint
+
+	for _, cw := range m.Payload {
+		if cw.Type != CodewordTypeMessage {
+			continue
+		}
+
+		payload := cw.Payload()
+		for a := 19; a >= 0; a -= 1 {
+			value |= uint8((payload>>uint(a))&1) << n
+			n += 1
+
+			if n == size {
+				fn(value)
+				value = 0
+				n = 0
+			}
+		}
+	}
+}
+
+// estimateMessageType tries to figure out if a message is in alpha-numeric format
+// or Bitcoded decimal format. There is not always a clear indication which is correct,
+// so we try to guess based on some assumptions:
+// 1) Alpha numeric messages contains mostly printable charaters.
+// 2) BCD messages are usually shorter.
+func (m *Message) estimateMessageType(persumed_alpha, persumed_bcd string) MessageType {
+
+	// MessageTypeAuto...
+	// Start guessing
+
+	odds_a := 0
+	odds_b := 0
+
+	specials_a := 0
+	specials_b := 0
+	const alphanum = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 *.,-()<>\n\r"
+	const bcdnum = "0123456789"
+
+	for _, char := range persumed_alpha {
+		r := rune(char)
+		if strings.IndexRune(alphanum, r) < 0 {
+			specials_a++
+		}
+	}
+
+	for _, char := range persumed_bcd {
+		r := rune(char)
+		if strings.IndexRune(bcdnum, r) < 0 {
+			specials_b++
+		}
+	}
+
+	partspecial_a := float32(specials_a) / float32(len(persumed_alpha))
+	partspecial_b := float32(specials_b) / float32(len(persumed_bcd))
+
+	if partspecial_a < 0.2 {
+		odds_a += 2
+	}
+
+	if partspecial_a >= 0.2 {
+		odds_a += 1
+	}
+
+	if partspecial_a >= 0.50 {
+		odds_b += 2
+	}
+
+	// special charaters are uncommon in bcd messages
+	if partspecial_b == 0 {
+		odds_b += 2
+	}
+
+	if partspecial_b >= 0.1 {
+		odds_a += 1
+	}
+
+	if len(persumed_alpha) > 25 {
+		odds_a += 2
+	}
+
+	if len(persumed_alpha) > 40 {
+		odds_a += 3
+	}
+
+	if m.options.debug(0) {
+		red.Printf("odds: %d/%d\nspecial: %d/%d (%0.0f%%)\n\n", odds_a, odds_b, specials_a, specials_b, (partspecial_a * 100))
+	}
+
+	if odds_a > odds_b {
+		return MessageTypeAlphanumeric
+	} else {
+		return MessageTypeBitcodedDecimal
+	}
+
+}
+
+//-----------------------------
+// Batch
+// Contains codewords. We keep the 16 codewords in a single list, the frame
+// of each codeword is kept on the codeword since it's part of the address.
+// Inverted is set if the batch was received with inverted polarity, and Bridged if
+// the sync codeword was missed and the batch position given by the previous batch.
+// Start is the index of the first bit of the first codeword in the bits parsed.
+type Batch struct {
+	Codewords [16]Codeword
+	Inverted  bool
+	Bridged   bool
+	Start     int
+}
+
+func NewBatch(bits []datatypes.Bit) (*Batch, error) {
+	return NewSoftBatch(bits, nil)
+}
+
+// NewSoftBatch creates a batch from bits with the confidence of every bit, nil
+// disables soft decoding.
+func NewSoftBatch(bits []datatypes.Bit, confidence []float64) (*Batch, error) {
+	if len(bits) != POCSAG_BATCH_LEN {
+		return nil, fmt.Errorf("invalid number of bits in batch: %d", len(bits))
+	}
+
+	b := &Batch{}
+	b.parse(bits, confidence, false)
+	return b, nil
+}
+
+// parse packs the bits to codewords and checks them, inverting every word if
+// inverted is set
+func (b *Batch) parse(bits []datatypes.Bit, confidence []float64, inverted bool) {
+
+	for i := range b.Codewords {
+		a := i * POCSAG_CODEWORD_LEN
+
+		word := utils.PackBits(bits[a : a+POCSAG_CODEWORD_LEN])
+		if inverted {
+			word = ^word
+		}
+
+		var wordconfidence []float64
+		if confidence != nil {
+			wordconfidence = confidence[a : a+POCSAG_CODEWORD_LEN]
+		}
+
+		b.Codewords[i] = parseCodeword(word, wordconfidence)
+		// two codewords per frame
+		b.Codewords[i].Frame = i / 2
+	}
+}
+
+// mostlyValid returns true if at least half of the codewords pass the parity check
+// with at most one corrected bit. Almost half of all random words can be corrected
+// to a valid codeword with two bit corrections, so those are not counted.
+func (b *Batch) mostlyValid() bool {
+	valid := 0
+	for _, w := range b.Codewords {
+		if w.ValidParity && w.BitCorrections <= 1 {
+			valid += 1
+		}
+	}
+	return valid*2 >= len(b.Codewords)
+}
+
+// Print will print a list with the codewords of this bach. FOr debugging.
+func (b *Batch) Print() {
+	for _, w := range b.Codewords {
+		w.Print()
+	}
+}
+
+//-----------------------------
+// Codeword contains the actual data. There are two codewords per frame,
+// and there are 8 frames per batch.
+// Type can be either Address or Message, and a special Idle codeword will occur
+// from time to time.
+// Word holds the 32 bits as received, after bit correction, with the first bit
+// received as the most significant. ValidParity is set on creation for later
+// reference.
+// Frame is the position (0-7) of the frame in the batch, which holds the
+// three lowest bits of the address.
+// SoftDecoded is set if the codeword was rescued by soft decoding.
+type Codeword struct {
+	Type        CodewordType
+	Word        uint32
+	ValidParity bool
+	Frame       int
+
+	BitCorrections int
+	SoftDecoded    bool
+}
+
+// NewCodeword takes 32 bits, creates a new codeword construct, sets the type and checks for parity errors.
+func NewCodeword(bits []datatypes.Bit) (*Codeword, error) {
+	return NewSoftCodeword(bits, nil)
+}
+
+// NewSoftCodeword is NewCodeword with the confidence of every bit. If the parity
+// bits can not correct the codeword, it is soft decoded. nil disables soft decoding.
+func NewSoftCodeword(bits []datatypes.Bit, confidence []float64) (*Codeword, error) {
+	if len(bits) != 32 {
+		return nil, fmt.Errorf("invalid number of bits for codeword: %d", len(bits))
+	}
+
+	c := parseCodeword(utils.PackBits(bits), confidence)
+	return &c, nil
+}
+
+// parseCodeword corrects a packed codeword and sets the type. The codeword is
+// returned by value so that batches hold their codewords without allocations.
+func parseCodeword(received uint32, confidence []float64) Codeword {
+
+	word, corrected, _ := CorrectCodeword(received)
+
+	// soft decoding starts over from the received word, so that the bits flipped
+	// by the hard correction are weighed and counted as well
+	soft := false
+	if confidence != nil && !validWord(word) {
+		if softword, softcorrected, ok := SoftCorrection(received, confidence); ok {
+			word = softword
+			corrected = softcorrected
+			soft = true
+		}
+	}
+
+	mtype := CodewordTypeAddress
+	if word&(1<<31) > 0 {
+		mtype = CodewordTypeMessage
+	}
+
+	if word == POCSAG_IDLE {
+		mtype = CodewordTypeIdle
+	}
+
+	return Codeword{
+		Type:           mtype,
+		Word:           word,
+		ValidParity:    validWord(word),
+		BitCorrections: corrected,
+		SoftDecoded:    soft,
+	}
+}
+
+// BitCorrection will attempt to correct the codeword to make it validate with the
+// parity bits. This can correct up to two errounous bits from transmission.
+// If the codeword can not be corrected the bits are returned as they are.
+func BitCorrection(inbits []datatypes.Bit) (bits []datatypes.Bit, corrections int) {
+
+	word, corrections, ok := CorrectCodeword(utils.PackBits(inbits))
+	if !ok {
+		bits = make([]datatypes.Bit, 32)
+		copy(bits, inbits)
+		return bits, 0
+	}
+
+	return utils.Uint32ToBits(word), corrections
+}
+
+// CorrectCodeword corrects up to two bit errors in the 31 BCH bits of a packed codeword
+// by looking up the error pattern of the syndrome. The even parity bit is not corrected.
+// ok is false if the codeword has more errors than can be corrected.
+func CorrectCodeword(word uint32) (corrected uint32, corrections int, ok bool) {
+
+	s := codewordSyndrome(word)
+	if s == 0 {
+		return word, 0, true
+	}
+
+	errors := syndromeTable[s]
+	if errors == 0 {
+		return word, 0, false
+	}
+
+	return word ^ errors, mathbits.OnesCount32(errors), true
+}
+
+// syndromeTable maps the syndrome of every single and double bit error in the
+// BCH bits to the error pattern, a mask over the packed codeword
+var syndromeTable = newSyndromeTable()
+
+func newSyndromeTable() *[1 << (BCH_N - BCH_K)]uint32 {
+
+	table := &[1 << (BCH_N - BCH_K)]uint32{}
+
+	// bit 0 is the even parity, the BCH bits are 1 to 31
+	for a := 1; a <= BCH_N; a += 1 {
+		single := uint32(1) << uint(a)
+		table[codewordSyndrome(single)] = single
+
+		for b := a + 1; b <= BCH_N; b += 1 {
+			double := single | uint32(1)<<uint(b)
+			table[codewordSyndrome(double)] = double
+		}
+	}
+
+	return table
+}
+
+// SoftCorrection attempts to correct a codeword that CorrectCodeword can not, Chase
+// style. Every combination of the CHASE_BITS least reliable bits is flipped before
+// CorrectCodeword is tried, and of the valid codewords found the one that flips the
+// least confident bits is kept. The codeword is only accepted if the summed confidence
+// of the flipped bits is at most SOFT_MAX_DISTANCE, otherwise noise would be
+// corrected to valid codewords as well.
+// The confidence is given per bit in the order received, the most significant first.
+func SoftCorrection(word uint32, confidence []float64) (corrected uint32, corrections int, ok bool) {
+
+	weakest := weakestBits(confidence)
+	best := -1.0
+
+	for pattern := 0; pattern < 1<<uint(CHASE_BITS); pattern += 1 {
+
+		candidate := word
+		for i, a := range weakest {
+			if pattern&(1<<uint(i)) > 0 {
+				candidate ^= 1 << uint(31-a)
+			}
+		}
+
+		candidate, _, _ = CorrectCodeword(candidate)
+		if !validWord(candidate) {
+			continue
+		}
+
+		distance := 0.0
+		flipped := candidate ^ word
+		for a := range confidence {
+			if flipped&(1<<uint(31-a)) > 0 {
+				distance += confidence[a]
+			}
+		}
+
+		if best < 0 || distance < best {
+			best = distance
+			corrected = candidate
+			corrections = mathbits.OnesCount32(flipped)
+		}
+	}
+
+	if best < 0 || best > SOFT_MAX_DISTANCE {
+		return word, 0, false
+	}
+
+	return corrected, corrections, true
+}
+
+// weakestBits returns the positions of the CHASE_BITS least confident bits, the
+// first position wins if two are equal
+func weakestBits(confidence []float64) [CHASE_BITS]int {
+
+	var weakest [CHASE_BITS]int
+	found := 0
+
+	for a := range confidence {
+		// insert in order, dropping the most confident if full
+		i := found
+		for i > 0 && confidence[a] < confidence[weakest[i-1]] {
+			if i < CHASE_BITS {
+				weakest[i] = weakest[i-1]
+			}
+			i -= 1
+		}
+		if i < CHASE_BITS {
+			weakest[i] = a
+		}
+		if found < CHASE_BITS {
+			found += 1
+		}
+	}
+
+	return weakest
+}
+
+// validWord returns true if both the BCH and the even parity checks pass
+func validWord(word uint32) bool {
+	return codewordSyndrome(word) == 0 && mathbits.OnesCount32(word)%2 == 0
+}
+
+// Print the codeword contents and type to terminal. For debugging.
+func (c *Codeword) Print() {
+
+	payload := ""
+	var color *color.Color = blue
+
+	switch c.Type {
+
+	case CodewordTypeAddress:
+		payload = c.Adress()
+		color = red
+
+	case CodewordTypeMessage:
+		payload = ""
+		color = green
+
+	default:
+		color = blue
+
+	}
+
+	parity := utils.TernaryStr(c.ValidParity, "", "*")
+	color.Printf("%s %s %s ", c.Type, payload, parity)
+	corr := c.BitCorrections
+	if corr > 0 {
+		color.Printf("%d bits corrected", corr)
+	}
+	if c.SoftDecoded {
+		color.Printf(" by soft decoding")
+	}
+
+	println("")
+}
+
+// Print the address for debugging
+func (c *Codeword) Adress() string {
+	return fmt.Sprintf("%d:%d%d", c.Capcode(), (c.Word>>12)&1, (c.Word>>11)&1)
+}
+
+// Uint32 returns the codeword as the 32 bits received, after bit correction.
+func (c *Codeword) Uint32() uint32 {
+	return c.Word
+}
+
+// Bits returns the codeword as a bitstream, the reverse of utils.PackBits
+func (c *Codeword) Bits() []datatypes.Bit {
+	return utils.Uint32ToBits(c.Word)
+}
+
+// Payload returns the 20 bits following the message flag, the address and
+// function bits of an address codeword or the data of a message codeword.
+func (c *Codeword) Payload() uint32 {
+	return (c.Word >> 11) & 0xFFFFF
+}
+
+// Hex returns the codeword as 8 hexadecimal digits
+func (c *Codeword) Hex() string {
+	return fmt.Sprintf("%08X", c.Word)
+}
+
+// Capcode returns the 21 bit address of an address codeword. The 18 most
+// significant bits are sent in the codeword, the 3 least significant bits
+// are given by the frame the codeword is placed in.
+func (c *Codeword) Capcode() uint32 {
+	return (c.Payload()>>2)<<3 | uint32(c.Frame)
+}
+
+// Function returns the 2 function bits of an address codeword
+func (c *Codeword) Function() uint8 {
+	return uint8(c.Payload() & 3)
+}
+
+// Utilities
+
+// invertBits returns a copy of the bits with every bit inverted
+func invertBits(bits []datatypes.Bit) []datatypes.Bit {
+	inverted := make([]datatypes.Bit, len(bits))
+	for i, b := range bits {
+		inverted[i] = !b
+	}
+	return inverted
+}
+
+const (
+	BHC_COEFF = 0xED200000
+	BCH_N     = 31
+	BCH_K     = 21
+)
+
+// syndrome takes a bitstream and uses the parity bits from the BCH polynomial
+// generator to calculate if the bits are received correctly.
+// A 0 return means the bits are correct.
+// Thanks to multimon-ng (https://github.com/EliasOenal/multimon-ng) for
+// detailing implmentation of this.
+func syndrome(bits []datatypes.Bit) uint32 {
+	return codewordSyndrome(utils.PackBits(bits))
+}
+
+// codewordSyndrome is syndrome for a packed codeword
+func codewordSyndrome(word uint32) uint32 {
+
+	// take the parity-bit out from our codeword
+	codeword := word >> 1
+
+	// put the mask bit to the far left in the bitstream
+	mask := uint32(1 << (BCH_N))
+	coeff := uint32(BHC_COEFF)
+
+	// step over each data-bit (the first 21)
+	for a := 0; a < BCH_K; a += 1 {
+		// step the coefficient and mask right in the bitstream
+		mask >>= 1
+		coeff >>= 1
+
+		// if the current bit in the codeword is 1 then XOR the codeword with the coefficient
+		if (codeword & mask) > 0 {
+			codeword = codeword ^ coeff
+		}
+	}
+
+	// in the end, if the coefficient matches the codeword they
+	// are canceled out by the XOR, returning 0
+
+	return codeword
+}
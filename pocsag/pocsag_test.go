@@ -0,0 +1,625 @@
+package pocsag
+
+import (
+	"encoding/json"
+	. "gopkg.in/check.v1"
+	"math/rand"
+	"testing"
+
+	"github.com/dhogborg/go-pocsag/internal/datatypes"
+	"github.com/dhogborg/go-pocsag/internal/utils"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&PocsagSuite{})
+
+type PocsagSuite struct{}
+
+func (f *PocsagSuite) Test_Syndrome_Calculation_Normal_Address(c *C) {
+	// valid bitstream
+	bits := bitstream("01010001111011110011110111000010")
+	syndr := syndrome(bits)
+
+	c.Assert(syndr > 0, Equals, false)
+}
+
+func (f *PocsagSuite) Test_Syndrome_Calculation_Normal_Idle(c *C) {
+	// valid bitstream
+	bits := bitstream("01111010100010011100000110010111")
+	syndr := syndrome(bits)
+
+	c.Assert(syndr > 0, Equals, false)
+}
+
+func (f *PocsagSuite) Test_Syndrome_Calculation_Normal_Message(c *C) {
+	// valid bitstream
+	bits := bitstream("11001101100000000000011110001100")
+	syndr := syndrome(bits)
+
+	c.Assert(syndr > 0, Equals, false)
+}
+
+func (f *PocsagSuite) Test_Syndrome_Calculation_Error_1(c *C) {
+	//                      v error
+	bits := bitstream("01010101111011110011110111000010")
+	syndr := syndrome(bits)
+
+	c.Assert(syndr > 0, Equals, true)
+}
+
+func (f *PocsagSuite) Test_Syndrome_Calculation_Error_2(c *C) {
+	//                   v  v errors
+	bits := bitstream("01110101111011110011110111000010")
+	syndr := syndrome(bits)
+
+	c.Assert(syndr > 0, Equals, true)
+
+}
+
+func (f *PocsagSuite) Test_BitCorrection_No_Rrror(c *C) {
+
+	bits := bitstream("01010001111011110011110111000010")
+	cbits, corr := BitCorrection(bits)
+	stream := streambits(cbits)
+
+	c.Assert(corr, Equals, 0)
+	c.Assert(stream, Equals, "01010001111011110011110111000010")
+}
+
+func (f *PocsagSuite) Test_BitCorrection_PayloadError(c *C) {
+	//                      v error
+	bits := bitstream("01010101111011110011110111000010")
+	cbits, corr := BitCorrection(bits)
+	stream := streambits(cbits)
+
+	c.Assert(corr, Equals, 1)
+	c.Assert(stream, Equals, "01010001111011110011110111000010")
+}
+
+func (f *PocsagSuite) Test_BitCorrection_PayloadErrors(c *C) {
+
+	//                      v errors       v
+	bits := bitstream("01010101111011110011010111000010")
+	cbits, corr := BitCorrection(bits)
+	stream := streambits(cbits)
+
+	c.Assert(corr, Equals, 2)
+	c.Assert(stream, Equals, "01010001111011110011110111000010")
+}
+
+func (f *PocsagSuite) Test_BitCorrection_ParityError(c *C) {
+	//                                            v
+	bits := bitstream("01010001111011110011110111010010")
+	cbits, corr := BitCorrection(bits)
+	stream := streambits(cbits)
+
+	c.Assert(corr, Equals, 1)
+	c.Assert(stream, Equals, "01010001111011110011110111000010")
+}
+
+func (f *PocsagSuite) Test_CorrectCodeword_Matches_BruteForce(c *C) {
+	for _, word := range []uint32{0x51EF3DC2, POCSAG_IDLE, 0xCD80078C} {
+
+		// every single and double error in the BCH bits
+		for a := uint(1); a < 32; a += 1 {
+			for b := a; b < 32; b += 1 {
+				received := word ^ (1 << a) ^ (1 << b)
+
+				corrected, corr, ok := CorrectCodeword(received)
+				c.Assert(ok, Equals, true)
+				c.Assert(corrected, Equals, word)
+
+				bits, bruteCorr := bruteForceCorrection(utils.Uint32ToBits(received))
+				c.Assert(streambits(bits), Equals, streambits(utils.Uint32ToBits(corrected)))
+				c.Assert(corr, Equals, bruteCorr)
+			}
+		}
+	}
+
+	// random words, most with more errors than can be corrected
+	random := rand.New(rand.NewSource(1))
+	for a := 0; a < 1000; a += 1 {
+		received := random.Uint32()
+
+		bits, corr := BitCorrection(utils.Uint32ToBits(received))
+		bruteBits, bruteCorr := bruteForceCorrection(utils.Uint32ToBits(received))
+
+		c.Assert(streambits(bits), Equals, streambits(bruteBits))
+		c.Assert(corr, Equals, bruteCorr)
+	}
+}
+
+func (f *PocsagSuite) Test_CorrectCodeword_Uncorrectable(c *C) {
+	_, corr, ok := CorrectCodeword(0x51EF3DC2 ^ 0x0E000000)
+	c.Assert(ok, Equals, false)
+	c.Assert(corr, Equals, 0)
+}
+
+func (f *PocsagSuite) Test_Codeword_Packed(c *C) {
+	bits := bitstream("01010001111011110011110111000010")
+
+	word, err := NewCodeword(bits)
+	c.Assert(err, IsNil)
+	c.Assert(word.Word, Equals, uint32(0x51EF3DC2))
+	c.Assert(streambits(word.Bits()), Equals, streambits(bits))
+	c.Assert(word.Payload(), Equals, uint32(0xA3DE7))
+	c.Assert(word.Adress(), Equals, "1342408:11")
+}
+
+func (f *PocsagSuite) Test_Packed_Parsing_Allocations(c *C) {
+	e := NewEncoder(Options{})
+	bits, err := e.Bits(testpages)
+	c.Assert(err, IsNil)
+
+	// the first batch, after the preamble and sync codeword
+	batchbits := bits[POCSAG_PREAMBLE_LEN+32 : POCSAG_PREAMBLE_LEN+32+POCSAG_BATCH_LEN]
+	confidence := make([]float64, len(batchbits))
+	for a := range confidence {
+		confidence[a] = 1
+	}
+	confidence[3] = 0.1
+	batchbits[3] = !batchbits[3]
+
+	batch := &Batch{}
+	allocs := testing.AllocsPerRun(100, func() {
+		batch.parse(batchbits, confidence, false)
+	})
+	c.Assert(allocs, Equals, 0.0)
+
+	weak, weakconfidence := weakened(0.2)
+	word := utils.PackBits(weak)
+	allocs = testing.AllocsPerRun(100, func() {
+		SoftCorrection(word, weakconfidence)
+	})
+	c.Assert(allocs, Equals, 0.0)
+}
+
+func (f *PocsagSuite) Test_Message_Packed_Decoding_Matches_Bits(c *C) {
+	random := rand.New(rand.NewSource(1))
+
+	for length := 1; length < 10; length += 1 {
+		addr, _ := NewCodeword(bitstream("01010001111011110011110111000010"))
+		m := NewMessage(addr)
+
+		bits := []datatypes.Bit{}
+		for a := 0; a < length; a += 1 {
+			word, _ := NewCodeword(utils.Uint32ToBits(encodeCodeword(0x100000 | random.Uint32()&0xFFFFF)))
+			m.AddPayload(word)
+			bits = append(bits, word.Bits()[1:21]...)
+		}
+
+		c.Assert(m.alphaString(), Equals, m.AlphaPayloadString(bits))
+		c.Assert(m.bcdString(), Equals, utils.BitcodedDecimals(bits))
+	}
+}
+
+func (f *PocsagSuite) Test_Batch_Capcode_From_Frame(c *C) {
+	idle := "01111010100010011100000110010111"
+	addr := "01010001111011110011110111000010"
+
+	// address codeword as the second codeword in frame 3
+	stream := ""
+	for a := 0; a < 16; a += 1 {
+		if a == 7 {
+			stream += addr
+		} else {
+			stream += idle
+		}
+	}
+
+	batch, err := NewBatch(bitstream(stream))
+	c.Assert(err, IsNil)
+
+	cw := &batch.Codewords[7]
+	c.Assert(cw.Frame, Equals, 3)
+	c.Assert(cw.Capcode(), Equals, uint32(1342411))
+	c.Assert(cw.Function(), Equals, uint8(3))
+
+	m := NewMessage(cw)
+	c.Assert(m.Capcode, Equals, uint32(1342411))
+	c.Assert(m.Function, Equals, uint8(3))
+	c.Assert(m.ReciptientString(), Equals, "1342411")
+}
+
+func (f *PocsagSuite) Test_ParseMessages_ToneOnly(c *C) {
+	idle := "01111010100010011100000110010111"
+	addr := "01010001111011110011110111000010"
+	msg := "11001101100000000000011110001100"
+
+	// tone only followed by an address with a message codeword
+	stream := addr + idle + addr + msg
+	for a := 4; a < 16; a += 1 {
+		stream += idle
+	}
+
+	batch, err := NewBatch(bitstream(stream))
+	c.Assert(err, IsNil)
+
+	p := NewPOCSAG(Options{})
+	messages := p.ParseMessages([]*Batch{batch})
+
+	c.Assert(len(messages), Equals, 2)
+
+	c.Assert(messages[0].IsToneOnly(), Equals, true)
+	c.Assert(messages[0].Type(MessageTypeAuto), Equals, MessageTypeToneOnly)
+	c.Assert(messages[0].PayloadString(MessageTypeAlphanumeric), Equals, "")
+	c.Assert(messages[0].Function, Equals, uint8(3))
+
+	c.Assert(messages[1].IsToneOnly(), Equals, false)
+	c.Assert(messages[1].Type(MessageTypeBitcodedDecimal), Equals, MessageTypeBitcodedDecimal)
+}
+
+func (f *PocsagSuite) Test_Codeword_Hex(c *C) {
+	word, err := NewCodeword(bitstream("01010001111011110011110111000010"))
+	c.Assert(err, IsNil)
+	c.Assert(word.Hex(), Equals, "51EF3DC2")
+
+	word, err = NewCodeword(bitstream("11001101100000000000011110001100"))
+	c.Assert(err, IsNil)
+	c.Assert(word.Hex(), Equals, "CD80078C")
+}
+
+// weakened returns the address codeword 51EF3DC2 with three bits flipped, one more
+// than the parity bits can correct, and the confidence of every bit
+func weakened(weak float64) ([]datatypes.Bit, []float64) {
+	bits := bitstream("01010001111011110011110111000010")
+	confidence := make([]float64, len(bits))
+	for a := range confidence {
+		confidence[a] = 1
+	}
+
+	for _, a := range []int{4, 15, 27} {
+		bits[a] = !bits[a]
+		confidence[a] = weak
+	}
+
+	return bits, confidence
+}
+
+func (f *PocsagSuite) Test_SoftCorrection_Rescues_Weak_Bits(c *C) {
+	bits, confidence := weakened(0.2)
+
+	word, err := NewCodeword(bits)
+	c.Assert(err, IsNil)
+	c.Assert(word.ValidParity, Equals, false)
+
+	word, err = NewSoftCodeword(bits, confidence)
+	c.Assert(err, IsNil)
+	c.Assert(word.ValidParity, Equals, true)
+	c.Assert(word.SoftDecoded, Equals, true)
+	c.Assert(word.BitCorrections, Equals, 3)
+	c.Assert(word.Hex(), Equals, "51EF3DC2")
+}
+
+func (f *PocsagSuite) Test_SoftCorrection_Rejects_Strong_Bits(c *C) {
+	// the flipped bits are as reliable as the rest, nothing tells them apart
+	bits, confidence := weakened(1)
+
+	word, err := NewSoftCodeword(bits, confidence)
+	c.Assert(err, IsNil)
+	c.Assert(word.ValidParity, Equals, false)
+	c.Assert(word.SoftDecoded, Equals, false)
+}
+
+func (f *PocsagSuite) Test_SoftCorrection_Counts_Hard_Corrections(c *C) {
+	// a strong BCH error and a weak parity error, the hard correction fixes the
+	// first but leaves the parity wrong
+	bits := bitstream("01010001111011110011110111000010")
+	confidence := make([]float64, len(bits))
+	for a := range confidence {
+		confidence[a] = 1
+	}
+	bits[10] = !bits[10]
+	bits[31] = !bits[31]
+	confidence[31] = 0.2
+
+	word, err := NewSoftCodeword(bits, confidence)
+	c.Assert(err, IsNil)
+	c.Assert(word.ValidParity, Equals, true)
+	c.Assert(word.SoftDecoded, Equals, true)
+	c.Assert(word.BitCorrections, Equals, 2)
+	c.Assert(word.Hex(), Equals, "51EF3DC2")
+}
+
+func (f *PocsagSuite) Test_Message_SoftDecoded(c *C) {
+	bits, confidence := weakened(0.2)
+	addr, _ := NewSoftCodeword(bits, confidence)
+	msg, _ := NewCodeword(bitstream("11001101100000000000011110001100"))
+
+	m := NewMessage(addr)
+	m.AddPayload(msg)
+
+	c.Assert(m.SoftDecoded(), Equals, 1)
+	c.Assert(m.IsValid(), Equals, true)
+}
+
+func (f *PocsagSuite) Test_Message_JSON(c *C) {
+	addr, _ := NewCodeword(bitstream("01010001111011110011110111000010"))
+	msg, _ := NewCodeword(bitstream("11001101100000000000011110001100"))
+
+	m := NewMessage(addr)
+	m.AddPayload(msg)
+	m.Baud = 1200
+
+	b, err := m.JSON(MessageTypeBitcodedDecimal)
+	c.Assert(err, IsNil)
+
+	decoded := map[string]interface{}{}
+	c.Assert(json.Unmarshal(b, &decoded), IsNil)
+
+	c.Assert(decoded["capcode"], Equals, float64(1342408))
+	c.Assert(decoded["function"], Equals, float64(3))
+	c.Assert(decoded["baud"], Equals, float64(1200))
+	c.Assert(decoded["type"], Equals, "bcd")
+	c.Assert(decoded["numeric"], Equals, m.PayloadString(MessageTypeBitcodedDecimal))
+	c.Assert(decoded["valid"], Equals, true)
+	c.Assert(decoded["codewords"], DeepEquals, []interface{}{"51EF3DC2", "CD80078C"})
+}
+
+func (f *PocsagSuite) Test_Message_JSON_Text(c *C) {
+	// the zero bits filling the last codeword are not part of the text
+	bits, err := NewEncoder(Options{}).Bits([]*Page{{Capcode: 8, Type: MessageTypeAlphanumeric, Text: "abc"}})
+	c.Assert(err, IsNil)
+
+	messages := ParsePOCSAG(bits, Options{})
+	c.Assert(len(messages), Equals, 1)
+
+	b, err := messages[0].JSON(MessageTypeAlphanumeric)
+	c.Assert(err, IsNil)
+
+	decoded := map[string]interface{}{}
+	c.Assert(json.Unmarshal(b, &decoded), IsNil)
+	c.Assert(decoded["text"], Equals, "abc")
+}
+
+// syncpages spans three batches
+var syncpages = []*Page{
+	{Capcode: 1342411, Function: 3, Type: MessageTypeAlphanumeric, Text: "A message long enough to continue in the second batch and then some more text in the third"},
+}
+
+// syncbits returns an encoded transmission and the positions of the sync codewords
+func syncbits(c *C) ([]datatypes.Bit, []int) {
+	bits, err := NewEncoder(Options{}).Bits(syncpages)
+	c.Assert(err, IsNil)
+
+	positions := []int{}
+	for a := POCSAG_PREAMBLE_LEN; a < len(bits); a += POCSAG_BATCH_LEN + 32 {
+		positions = append(positions, a)
+	}
+	c.Assert(len(positions), Equals, 3)
+
+	return bits, positions
+}
+
+func (f *PocsagSuite) Test_ParseBatches_Sync_Errors(c *C) {
+	bits, positions := syncbits(c)
+
+	// two bit errors in the second sync codeword
+	bits[positions[1]+3] = !bits[positions[1]+3]
+	bits[positions[1]+17] = !bits[positions[1]+17]
+
+	batches, err := NewPOCSAG(Options{SyncErrors: 2}).ParseBatches(bits)
+	c.Assert(err, IsNil)
+	c.Assert(len(batches), Equals, 3)
+	c.Assert(batches[1].Bridged, Equals, false)
+
+	// exact matching bridges the batch from the timing of the first
+	batches, err = NewPOCSAG(Options{}).ParseBatches(bits)
+	c.Assert(err, IsNil)
+	c.Assert(len(batches), Equals, 3)
+	c.Assert(batches[1].Bridged, Equals, true)
+}
+
+func (f *PocsagSuite) Test_ParseBatches_Bridge_Missed_Sync(c *C) {
+	bits, positions := syncbits(c)
+
+	// destroy the second sync codeword
+	for a := 0; a < 32; a += 1 {
+		bits[positions[1]+a] = false
+	}
+
+	batches, err := NewPOCSAG(Options{SyncErrors: 2}).ParseBatches(bits)
+	c.Assert(err, IsNil)
+	c.Assert(len(batches), Equals, 3)
+	c.Assert(batches[1].Bridged, Equals, true)
+
+	messages := NewPOCSAG(Options{}).ParseMessages(batches)
+	c.Assert(len(messages), Equals, 1)
+	c.Assert(messages[0].PayloadString(MessageTypeAlphanumeric), Equals, syncpages[0].Text)
+}
+
+func (f *PocsagSuite) Test_ParseBatches_No_Bridge_Into_Noise(c *C) {
+	bits, _ := syncbits(c)
+
+	// random data after the last batch is not a batch
+	random := rand.New(rand.NewSource(1))
+	for a := 0; a < 2*POCSAG_BATCH_LEN; a += 1 {
+		bits = append(bits, datatypes.Bit(random.Intn(2) == 1))
+	}
+
+	batches, err := NewPOCSAG(Options{SyncErrors: 2}).ParseBatches(bits)
+	c.Assert(err, IsNil)
+	c.Assert(len(batches), Equals, 3)
+}
+
+func (f *PocsagSuite) Test_ParseBatches_Inverted(c *C) {
+	bits, _ := syncbits(c)
+
+	batches, err := NewPOCSAG(Options{}).ParseBatches(invertBits(bits))
+	c.Assert(err, IsNil)
+	c.Assert(len(batches), Equals, 3)
+	c.Assert(batches[0].Inverted, Equals, true)
+
+	messages := NewPOCSAG(Options{}).ParseMessages(batches)
+	c.Assert(len(messages), Equals, 1)
+	c.Assert(messages[0].Capcode, Equals, uint32(1342411))
+}
+
+func (f *PocsagSuite) Test_Polarity_Detection(c *C) {
+	bits, _ := syncbits(c)
+
+	p := NewPOCSAG(Options{SyncErrors: 2})
+	c.Assert(p.Polarity(bits), Equals, PolarityNormal)
+	c.Assert(p.Polarity(invertBits(bits)), Equals, PolarityInverted)
+
+	messages := ParsePOCSAG(invertBits(bits), Options{})
+	c.Assert(len(messages), Equals, 1)
+	c.Assert(messages[0].Polarity, Equals, PolarityInverted)
+	c.Assert(messages[0].Capcode, Equals, uint32(1342411))
+}
+
+func (f *PocsagSuite) Test_Polarity_Forced(c *C) {
+	bits, _ := syncbits(c)
+
+	messages := ParsePOCSAG(invertBits(bits), Options{Polarity: PolarityNormal})
+	c.Assert(len(messages), Equals, 0)
+
+	messages = ParsePOCSAG(invertBits(bits), Options{Polarity: PolarityInverted})
+	c.Assert(len(messages), Equals, 1)
+	c.Assert(messages[0].Polarity, Equals, PolarityInverted)
+}
+
+func bitstream(stream string) []datatypes.Bit {
+	bits := make([]datatypes.Bit, len(stream))
+	for i, c := range stream {
+		if string(c) == "1" {
+			bits[i] = datatypes.Bit(true)
+		} else {
+			bits[i] = datatypes.Bit(false)
+		}
+	}
+	return bits
+}
+
+func streambits(bits []datatypes.Bit) string {
+	stream := ""
+	for _, c := range bits {
+		if c {
+			stream += "1"
+		} else {
+			stream += "0"
+		}
+	}
+	return stream
+}
+
+// bruteForceCorrection is the previous implementation of BitCorrection, flipping
+// every single and pair of bits until the syndrome is 0. Kept as a reference for
+// the lookup table.
+func bruteForceCorrection(inbits []datatypes.Bit) (bits []datatypes.Bit, corrections int) {
+
+	bits = make([]datatypes.Bit, 32)
+	corrections = 0
+
+	copy(bits, inbits)
+
+	if syndrome(bits) == 0 {
+		return
+	}
+
+	for a := 0; a < 31; a += 1 {
+
+		bits_x := make([]datatypes.Bit, 32)
+		copy(bits_x, bits)
+
+		bits_x[a] = !bits_x[a]
+
+		if syndrome(bits_x) == 0 {
+			bits = bits_x
+			corrections = 1
+			return
+		}
+
+		for b := 0; b < 31; b += 1 {
+			if b != a {
+
+				bits_xx := make([]datatypes.Bit, 32)
+				copy(bits_xx, bits_x)
+
+				bits_xx[b] = !bits_xx[b]
+
+				if syndrome(bits_xx) == 0 {
+					bits = bits_xx
+					corrections = 2
+					return
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// a valid address codeword with two bit errors, the worst case that can be corrected
+var benchmarkWord = uint32(0x51EF3DC2 ^ 0x00000110)
+
+func BenchmarkBitCorrection_BruteForce(b *testing.B) {
+	bits := utils.Uint32ToBits(benchmarkWord)
+	for i := 0; i < b.N; i += 1 {
+		bruteForceCorrection(bits)
+	}
+}
+
+func BenchmarkBitCorrection(b *testing.B) {
+	bits := utils.Uint32ToBits(benchmarkWord)
+	for i := 0; i < b.N; i += 1 {
+		BitCorrection(bits)
+	}
+}
+
+func BenchmarkCorrectCodeword(b *testing.B) {
+	for i := 0; i < b.N; i += 1 {
+		CorrectCodeword(benchmarkWord)
+	}
+}
+
+func BenchmarkBitCorrection_Uncorrectable_BruteForce(b *testing.B) {
+	bits := utils.Uint32ToBits(0x51EF3DC2 ^ 0x0E000000)
+	for i := 0; i < b.N; i += 1 {
+		bruteForceCorrection(bits)
+	}
+}
+
+func BenchmarkCorrectCodeword_Uncorrectable(b *testing.B) {
+	for i := 0; i < b.N; i += 1 {
+		CorrectCodeword(0x51EF3DC2 ^ 0x0E000000)
+	}
+}
+
+func BenchmarkParseBatches(b *testing.B) {
+	bits, err := NewEncoder(Options{}).Bits(testpages)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	p := NewPOCSAG(Options{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i += 1 {
+		p.ParseBatches(bits)
+	}
+}
+
+func (f *PocsagSuite) Test_ParseBatches_Truncated(c *C) {
+	bits, err := NewEncoder(Options{}).Bits(testpages)
+	c.Assert(err, IsNil)
+
+	full, err := NewPOCSAG(Options{}).ParseBatches(bits)
+	c.Assert(err, IsNil)
+
+	// the transmission ends in the middle of the 7th codeword of the last batch
+	bits = bits[:len(bits)-POCSAG_BATCH_LEN+6*32+16]
+
+	for _, b := range [][]datatypes.Bit{bits, invertBits(bits)} {
+		batches, err := NewPOCSAG(Options{}).ParseBatches(b)
+		c.Assert(err, IsNil)
+		c.Assert(len(batches), Equals, len(full))
+
+		last := batches[len(batches)-1]
+		c.Assert(last.Codewords[:6], DeepEquals, full[len(full)-1].Codewords[:6])
+		for _, cw := range last.Codewords[6:] {
+			c.Assert(cw.Type, Equals, CodewordTypeIdle)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package pocsag
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dhogborg/go-pocsag/internal/datatypes"
+	"github.com/dhogborg/go-pocsag/internal/utils"
+)
+
+type InputFormat string
+
+const (
+	// signed 16 bit samples
+	InputFormatAudio InputFormat = "audio"
+	// bits packed in bytes, MSB first, as written by the batch dumps
+	InputFormatBinary InputFormat = "bin"
+	// ASCII 0 and 1 characters
+	InputFormatBits InputFormat = "bits"
+	// 32 bit codewords as hexadecimal numbers
+	InputFormatHex InputFormat = "hex"
+
+	// interleaved IQ samples, demodulated by the stream reader
+	// unsigned 8 bit, as written by rtl_sdr
+	InputFormatIQU8 InputFormat = "iq-u8"
+	// signed 16 bit little endian
+	InputFormatIQS16 InputFormat = "iq-s16"
+	// 32 bit little endian floats
+	InputFormatIQF32 InputFormat = "iq-f32"
+)
+
+// IsIQ returns true for the complex IQ formats
+func (f InputFormat) IsIQ() bool {
+	return f.sampleSize() > 0
+}
+
+// sampleSize returns the number of bytes in one IQ sample, 0 if the format is not IQ
+func (f InputFormat) sampleSize() int {
+	switch f {
+	case InputFormatIQU8:
+		return 2
+	case InputFormatIQS16:
+		return 4
+	case InputFormatIQF32:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// IsRaw returns true for the formats holding already demodulated bits
+func (f InputFormat) IsRaw() bool {
+	return f == InputFormatBinary || f == InputFormatBits || f == InputFormatHex
+}
+
+// ReadBits reads a raw dump of an already demodulated transmission in the format
+// given, so that it can be passed directly to ParsePOCSAG.
+func ReadBits(source io.Reader, format InputFormat) ([]datatypes.Bit, error) {
+
+	switch format {
+	case InputFormatBinary:
+		return readBinaryBits(source)
+	case InputFormatBits:
+		return readASCIIBits(source)
+	case InputFormatHex:
+		return readHexCodewords(source)
+	default:
+		return nil, fmt.Errorf("invalid raw input format: %s", format)
+	}
+}
+
+// readBinaryBits unpacks bytes to bits in MSB to LSB order
+func readBinaryBits(source io.Reader) ([]datatypes.Bit, error) {
+
+	data, err := io.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := make([]datatypes.Bit, 0, len(data)*8)
+	for _, b := range data {
+		for a := uint(0); a < 8; a += 1 {
+			bits = append(bits, datatypes.Bit((b>>(7-a))&1 == 1))
+		}
+	}
+
+	return bits, nil
+}
+
+// readASCIIBits reads 0 and 1 characters, whitespace is ignored
+func readASCIIBits(source io.Reader) ([]datatypes.Bit, error) {
+
+	data, err := io.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := make([]datatypes.Bit, 0, len(data))
+	for _, c := range string(data) {
+		switch c {
+		case '0':
+			bits = append(bits, false)
+		case '1':
+			bits = append(bits, true)
+		case ' ', '\t', '\r', '\n':
+		default:
+			return nil, fmt.Errorf("invalid character in bitstream: %q", c)
+		}
+	}
+
+	return bits, nil
+}
+
+// readHexCodewords reads codewords as hexadecimal numbers separated by whitespace or
+// commas, with or without a 0x prefix. If the list does not start with a sync codeword,
+// the codewords are taken as batches and a sync codeword is put before every 16, the
+// last batch is filled up with idle codewords.
+func readHexCodewords(source io.Reader) ([]datatypes.Bit, error) {
+
+	words := []uint32{}
+
+	scanner := bufio.NewScanner(source)
+	scanner.Split(bufio.ScanWords)
+
+	for scanner.Scan() {
+		for _, field := range strings.Split(scanner.Text(), ",") {
+			if field == "" {
+				continue
+			}
+
+			field = strings.TrimPrefix(strings.ToLower(field), "0x")
+			word, err := strconv.ParseUint(field, 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid codeword: %s", field)
+			}
+			words = append(words, uint32(word))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	synced := len(words) > 0 && words[0] == POCSAG_PREAMBLE
+
+	for !synced && len(words)%16 != 0 {
+		words = append(words, POCSAG_IDLE)
+	}
+
+	bits := []datatypes.Bit{}
+	for i, word := range words {
+		if !synced && i%16 == 0 {
+			bits = append(bits, utils.Uint32ToBits(POCSAG_PREAMBLE)...)
+		}
+		bits = append(bits, utils.Uint32ToBits(word)...)
+	}
+
+	return bits, nil
+}
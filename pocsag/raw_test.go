@@ -0,0 +1,86 @@
+package pocsag
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/dhogborg/go-pocsag/internal/utils"
+)
+
+var _ = Suite(&RawSuite{})
+
+type RawSuite struct{}
+
+func (f *RawSuite) Test_ReadBits_Binary(c *C) {
+	bits, err := ReadBits(bytes.NewReader([]byte{0x7C, 0xD2, 0x15, 0xD8}), InputFormatBinary)
+	c.Assert(err, IsNil)
+	c.Assert(streambits(bits), Equals, "01111100110100100001010111011000")
+}
+
+func (f *RawSuite) Test_ReadBits_ASCII(c *C) {
+	bits, err := ReadBits(strings.NewReader("0111 1100\n1101\n"), InputFormatBits)
+	c.Assert(err, IsNil)
+	c.Assert(streambits(bits), Equals, "011111001101")
+
+	_, err = ReadBits(strings.NewReader("0102"), InputFormatBits)
+	c.Assert(err, NotNil)
+}
+
+func (f *RawSuite) Test_ReadBits_Hex_Adds_Sync(c *C) {
+	bits, err := ReadBits(strings.NewReader("0x51EF3DC2, 7A89C197\n7a89c197"), InputFormatHex)
+	c.Assert(err, IsNil)
+	c.Assert(len(bits), Equals, 17*32)
+	c.Assert(utils.Btouint32(utils.MSBBitsToBytes(bits[0:32], 8)), Equals, POCSAG_PREAMBLE)
+	c.Assert(utils.Btouint32(utils.MSBBitsToBytes(bits[32:64], 8)), Equals, uint32(0x51EF3DC2))
+	// the batch is filled up with idle codewords
+	c.Assert(utils.Btouint32(utils.MSBBitsToBytes(bits[16*32:], 8)), Equals, POCSAG_IDLE)
+
+	_, err = ReadBits(strings.NewReader("51EF3DCG"), InputFormatHex)
+	c.Assert(err, NotNil)
+}
+
+func (f *RawSuite) Test_ReadBits_Hex_Roundtrip(c *C) {
+	batches, err := NewEncoder(Options{}).Codewords(testpages)
+	c.Assert(err, IsNil)
+
+	list := ""
+	for _, batch := range batches {
+		for _, word := range batch {
+			list += fmt.Sprintf("%08X\n", word)
+		}
+	}
+
+	bits, err := ReadBits(strings.NewReader(list), InputFormatHex)
+	c.Assert(err, IsNil)
+
+	assertTestpages(c, ParsePOCSAG(bits, Options{}))
+}
+
+func (f *RawSuite) Test_ReadBits_Hex_Partial_Batch(c *C) {
+	// dumps from other receivers are rarely aligned to batches
+	for _, list := range []string{
+		"51EF3DC2 CD80078C 7A89C197",
+		"7CD215D8 51EF3DC2 CD80078C",
+	} {
+		bits, err := ReadBits(strings.NewReader(list), InputFormatHex)
+		c.Assert(err, IsNil)
+
+		messages := ParsePOCSAG(bits, Options{})
+		c.Assert(len(messages), Equals, 1)
+		c.Assert(messages[0].Capcode, Equals, uint32(1342408))
+		c.Assert(messages[0].PayloadString(MessageTypeBitcodedDecimal), Equals, "9-000")
+	}
+}
+
+func (f *RawSuite) Test_ReadBits_Binary_Roundtrip(c *C) {
+	encoded, err := NewEncoder(Options{}).Bits(testpages)
+	c.Assert(err, IsNil)
+
+	bits, err := ReadBits(bytes.NewReader(utils.MSBBitsToBytes(encoded, 8)), InputFormatBinary)
+	c.Assert(err, IsNil)
+
+	assertTestpages(c, ParsePOCSAG(bits, Options{}))
+}
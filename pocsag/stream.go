@@ -0,0 +1,493 @@
+package pocsag
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dhogborg/go-pocsag/internal/datatypes"
+	"github.com/dhogborg/go-pocsag/internal/utils"
+	"github.com/dhogborg/go-pocsag/internal/wav"
+)
+
+// Baudrates known to the automatic baud detection
+var Bauds = []int{512, 1200, 2400}
+
+type StreamReader struct {
+	Stream *bufio.Reader
+	// baud 0 for auto, samplerate in samples per second
+	options Options
+	filter  *Filter
+	// demodulator for IQ input, nil for audio
+	iq *IQDemodulator
+	// number of bytes read at a time
+	chunk int
+	// number of samples read from the source, at the audio samplerate
+	position int64
+	// unfiltered samples of the transmission being read, kept with options.Record
+	recording []int16
+}
+
+// Transmission holds the bits sliced from a transmission found in the stream,
+// the baudrate it was decoded at and how well the bit clock was recovered.
+// Confidence holds the reliability of each bit for soft decoding, and Frequency
+// is the channel frequency for IQ input, 0 for audio. Channel is the channel of
+// multichannel audio input counted from 1, 0 for mono. Recording is the path of
+// the wav file the transmission was saved to with options.Record.
+// Offset is the sample in the stream the first bit begins at, counted at the
+// audio samplerate SampleRate. Positions holds the samples each bit was sliced
+// at by the recovered clock, counted from the first bit. Without positions the
+// bits are taken to be spaced by the nominal bitlength.
+type Transmission struct {
+	Bits       []datatypes.Bit
+	Confidence []float64
+	Baud       int
+	Frequency  float64
+	Channel    int
+	Recording  string
+	Offset     int64
+	Positions  []int
+	SampleRate int
+	Timing     TimingStats
+}
+
+// NewStreamReader returns a new stream reader for the source provided.
+// Set options.Baud 0 for automatic detection. options.SampleRate is the number
+// of samples per second in the source and is used to determine the bitlength.
+// With one of the IQ formats as options.Input the source is FM demodulated, and
+// the bitlength is determined from the audio samplerate after decimation.
+// Audio with several interleaved channels, options.Channels, is read one channel
+// at a time, options.Channel.
+func NewStreamReader(source io.Reader, options Options) *StreamReader {
+
+	options = options.withDefaults()
+
+	var iq *IQDemodulator
+	chunk := 8192 * options.Channels
+
+	if options.Input.IsIQ() {
+		iq = NewIQDemodulator(options.Input, options.SampleRate, options.IQ)
+		// about as many audio samples per read as for audio input
+		chunk = 4096 * iq.decimation * options.Input.sampleSize()
+		options.SampleRate = iq.SampleRate()
+	}
+
+	return &StreamReader{
+		Stream:  bufio.NewReader(source),
+		options: options,
+		filter:  NewFilter(options.Filter, options.SampleRate, options.Baud),
+		iq:      iq,
+		chunk:   chunk,
+	}
+
+}
+
+// StartScan takes a channel on which transmissions will be written when found and parsed.
+// The scanner will continue until EOF is reached or the context is cancelled. A transmission
+// in progress at EOF is sent before returning. The channel is closed when the scan ends.
+// Reaching EOF is not an error, any other read error or the context error is returned.
+// A transmission that can not be recorded is sent without the recording, and the scan
+// ends with the error.
+func (s *StreamReader) StartScan(ctx context.Context, transmissions chan *Transmission) error {
+
+	defer close(transmissions)
+
+	if err := s.options.validate(); err != nil {
+		return err
+	}
+
+	// the chunk before the current, for the recording
+	var previous []int16
+
+	for {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// offset of the chunk in the stream
+		position := s.position
+
+		samples, err := s.read()
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// the recording begins with the chunk before the transmission is found,
+		// since the preamble is not found until well into it
+		if s.options.Record != "" {
+			s.recording = append(append(s.recording[:0], previous...), samples...)
+			previous = samples
+		}
+
+		_, stream := s.filter.Process(samples)
+
+		start, bitlength := s.ScanTransmissionStart(stream)
+
+		if start > 0 {
+
+			// the start is in the center of the first bit, of the delayed output
+			offset := position + int64(float64(start)-bitlength/2+0.5) - int64(s.filter.Delay())
+
+			received := s.timestamp(offset)
+			if s.options.debug(0) {
+				blue.Println("-- Transmission received at", received.Format(TIME_FORMAT), "--------------")
+			}
+
+			transmission, err := s.ReadTransmission(ctx, stream[start:])
+			if err != nil && err != io.EOF {
+				return err
+			}
+
+			bits, confidence, positions, timing := RecoverBits(transmission, bitlength)
+			baud := int(float64(s.options.SampleRate)/bitlength + 0.5)
+
+			recording := ""
+			var recerr error
+			if s.options.Record != "" {
+				recording, recerr = s.record(s.recording, received, baud)
+			}
+
+			if s.options.debug(0) {
+				blue.Println("Timing:", timing)
+			}
+
+			if s.options.debug(3) {
+				utils.PrintBitstream(bits)
+			}
+
+			select {
+			case transmissions <- &Transmission{
+				Bits:       bits,
+				Confidence: confidence,
+				Baud:       baud,
+				Frequency:  s.frequency(),
+				Channel:    s.channel(),
+				Recording:  recording,
+				Offset:     offset,
+				Positions:  positions,
+				SampleRate: s.options.SampleRate,
+				Timing:     timing,
+			}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			previous = nil
+
+			if recerr != nil {
+				return fmt.Errorf("error saving transmission: %s", recerr)
+			}
+
+			if err == io.EOF {
+				return nil
+			}
+		}
+
+	}
+}
+
+// ReadTransmission reads the beginning and subsequent datapackages into
+// a new buffer until encounters noise instead of signal.
+// If the stream ends before the noise the samples read so far are returned
+// along with io.EOF.
+func (s *StreamReader) ReadTransmission(ctx context.Context, beginning []int16) ([]int16, error) {
+
+	stream := make([]int16, 0)
+	stream = append(stream, beginning...)
+
+	for {
+
+		if err := ctx.Err(); err != nil {
+			return stream, err
+		}
+
+		samples, err := s.read()
+
+		if s.options.Record != "" {
+			s.recording = append(s.recording, samples...)
+		}
+
+		if len(samples) > 0 {
+
+			noise, bstr := s.filter.Process(samples)
+			stream = append(stream, bstr...)
+
+			if s.isNoise(noise) {
+				if s.options.debug(2) {
+					print("\n")
+					println("Transmission end (high noise level)")
+				}
+				break
+			}
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				_, tail := s.filter.Flush()
+				stream = append(stream, tail...)
+			}
+			return stream, err
+		}
+
+	}
+
+	return stream, nil
+}
+
+// ScanTransmissionStart scans for repeated 1010101010101 pattern of bits in the
+// stream. A minimum of 400 samples is required to sucessfully sync the receiver with
+// the stream. ScanTransmissionStart looks for when the signal wave changes from high to low
+// and reversed, and measures the distance between those changes. They should correspond to
+// the bitlength determined by the current baud-rate. An attempt at guessing the baudrate is
+// also made when a repeated pattern is found.
+// retuned is the index of the stream on which the caller should begin reading bits, and
+// the estimated bitlength, the number of samples between each bit center in transmission stream.
+// The bitlength is not necessarily an integer, 1200 baud at 44100 Hz is 36.75 samples per bit.
+func (s *StreamReader) ScanTransmissionStart(stream []int16) (int, float64) {
+
+	if len(stream) == 0 {
+		return -1, 0
+	}
+
+	switches := []int{}
+	prevsamp := stream[0]
+	first_switch := -1
+
+	// find the indexes where we cross the 0-boundary
+	// if we switch sides we store the index in an array for further analasys
+	for a, sample := range stream {
+
+		if (prevsamp > 0 && sample < 0) || (prevsamp < 0 && sample > 0) {
+			switches = append(switches, a)
+			if first_switch < 0 {
+				first_switch = a
+			}
+		}
+
+		prevsamp = sample
+	}
+
+	// find the mean distance between boundary corsses
+	sum := 0.0
+	for a := 0; a < len(switches)-1; a += 1 {
+		sum += float64(switches[a+1] - switches[a])
+	}
+
+	mean_bitlength := sum / float64(len(switches)-1)
+
+	bitlength := s.bitlength(mean_bitlength)
+
+	// if bitlength is not on a scale of known baudrates then
+	// we probably don't have a pocsag sync-transmission
+	if bitlength < 0 {
+		return -1, 0
+	}
+
+	if s.options.debug(0) {
+		blue.Println("Mean bitlength:", mean_bitlength)
+		blue.Println("Determined bitlength:", bitlength)
+	}
+
+	// look at every other sample to see if we have a repeating pattern with matching size
+	confidence := 0
+	for a := 0; a < len(switches)-3; a += 1 {
+
+		// length from switch a to a+1
+		w1 := float64(switches[a+1] - switches[a])
+		w2 := float64(switches[a+3] - switches[a+2])
+
+		// how much the persumed bits vary from eachother
+		intravariance := (w1 / w2) - 1
+		if intravariance < 0 {
+			intravariance = intravariance * -1
+		}
+
+		// how much the persumed bits vary from the determined bitlength
+		baudvariance := (w1 / bitlength) - 1
+		if baudvariance < 0 {
+			baudvariance = baudvariance * -1
+		}
+
+		// don't stray more than 20%
+		if intravariance < 0.2 && baudvariance < 0.2 {
+			confidence += 1
+		} else {
+			confidence = 0
+		}
+
+		if confidence > 10 {
+
+			if s.options.debug(0) {
+				blue.Println("Found bitsync")
+			}
+
+			return switches[a] + int(bitlength/2), bitlength
+		}
+
+	}
+
+	return -1, 0
+}
+
+// bitlength returns the proper bitlength from a calcualated mean distance between
+// wave transitions. If the baudrate is set by configuration then that is used instead.
+// The bitlength is derived from the samplerate, so a mean within 15% of the expected
+// bitlength for one of the known baudrates is accepted.
+func (s *StreamReader) bitlength(mean float64) float64 {
+
+	if s.options.Baud > 0 {
+		return float64(s.options.SampleRate) / float64(s.options.Baud)
+	}
+
+	for _, baud := range Bauds {
+		expected := float64(s.options.SampleRate) / float64(baud)
+
+		variance := (mean / expected) - 1
+		if variance < 0 {
+			variance = variance * -1
+		}
+
+		if variance < 0.15 {
+			return expected
+		}
+	}
+
+	return -1
+}
+
+// isNoise detects noise by calculating the number of times the signal goes over the 0-line
+// during a signal this value is between 25 and 50, but noise is above 100, usually around 300-400.
+// The stream should not be low-pass filtered, that would remove the noise we look for.
+func (s *StreamReader) isNoise(stream []int16) bool {
+
+	if len(stream) == 0 {
+		return false
+	}
+
+	prevsamp := stream[0]
+	switches := 0
+
+	// find the indexes where we cross the 0-boundary
+	for _, sample := range stream {
+
+		if (prevsamp > 0 && sample < 0) || (prevsamp < 0 && sample > 0) {
+			switches += 1
+		}
+
+		prevsamp = sample
+	}
+
+	switchrate := float32(switches) / float32(len(stream))
+
+	if s.options.debug(2) {
+		fmt.Printf("%0.0f ", switchrate*100)
+	}
+
+	return switchrate > 0.15
+}
+
+// record saves the samples of a transmission as a wav file in the record folder.
+// The samples are saved as received, before filtering, from the start of the
+// chunk before the one the transmission was found in, to include the preamble.
+// The name is made unique by the time, and the baudrate, channel and frequency
+// of the reader, since several readers may receive the same transmission.
+func (s *StreamReader) record(samples []int16, received time.Time, baud int) (string, error) {
+
+	name := received.Format("20060102_15.04.05.000") + fmt.Sprintf("_%d", baud)
+	if channel := s.channel(); channel != 0 {
+		name += fmt.Sprintf("_ch%d", channel)
+	}
+	if frequency := s.frequency(); frequency != 0 {
+		name += fmt.Sprintf("_%0.0fHz", frequency)
+	}
+
+	path := filepath.Join(s.options.Record, name+".wav")
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	out := bufio.NewWriter(file)
+	if err := wav.Write(out, uint32(s.options.SampleRate), samples); err != nil {
+		return "", err
+	}
+	if err := out.Flush(); err != nil {
+		return "", err
+	}
+
+	if s.options.debug(0) {
+		blue.Println("Saved transmission:", path)
+	}
+
+	return path, nil
+}
+
+// timestamp returns the wall clock time of a sample offset in the stream, or the
+// current time if the start time of the stream is not known
+func (s *StreamReader) timestamp(offset int64) time.Time {
+	if s.options.StartTime.IsZero() {
+		return time.Now()
+	}
+	return s.options.StartTime.Add(utils.SampleTime(offset, s.options.SampleRate))
+}
+
+// frequency returns the frequency of the channel read from IQ input
+func (s *StreamReader) frequency() float64 {
+	if s.iq == nil {
+		return 0
+	}
+	return s.options.IQ.Center + s.options.IQ.Offset
+}
+
+// channel returns the channel read from multichannel audio, counted from 1
+func (s *StreamReader) channel() int {
+	if s.iq != nil || s.options.Channels < 2 {
+		return 0
+	}
+	return s.options.Channel + 1
+}
+
+// read returns the next chunk of samples from the stream, IQ input is demodulated
+// to audio. A short chunk at the end of the stream is returned without error,
+// io.EOF is returned by the next read.
+func (s *StreamReader) read() ([]int16, error) {
+
+	bytes := make([]byte, s.chunk)
+	c, err := io.ReadFull(s.Stream, bytes)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	var samples []int16
+	if s.iq != nil {
+		samples = s.iq.Process(bytes[:c])
+	} else {
+		samples = s.bToInt16(bytes[:c])
+	}
+
+	s.position += int64(len(samples))
+	return samples, err
+}
+
+// bToInt16 converts bytes to int16, picking the selected channel out of
+// interleaved audio
+func (s *StreamReader) bToInt16(b []byte) (u []int16) {
+	channels := s.options.Channels
+	u = make([]int16, len(b)/2/channels)
+	for i, _ := range u {
+		in := (i*channels + s.options.Channel) * 2
+		val := int16(b[in])
+		val += int16(b[in+1]) << 8
+		u[i] = val
+	}
+	return
+}
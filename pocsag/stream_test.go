@@ -0,0 +1,132 @@
+package pocsag
+
+import (
+	"bytes"
+	"context"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&StreamSuite{})
+
+type StreamSuite struct{}
+
+func (f *StreamSuite) Test_Bitlength_48000(c *C) {
+	s := NewStreamReader(nil, Options{SampleRate: 48000})
+	c.Assert(s.bitlength(93.0), Equals, 93.75)
+	c.Assert(s.bitlength(40.0), Equals, 40.0)
+	c.Assert(s.bitlength(20.0), Equals, 20.0)
+}
+
+func (f *StreamSuite) Test_Bitlength_22050(c *C) {
+	s := NewStreamReader(nil, Options{SampleRate: 22050})
+	c.Assert(s.bitlength(43.0), Equals, 22050.0/512)
+	c.Assert(s.bitlength(18.0), Equals, 18.375)
+	c.Assert(s.bitlength(9.0), Equals, 9.1875)
+}
+
+func (f *StreamSuite) Test_Bitlength_Unknown(c *C) {
+	s := NewStreamReader(nil, Options{SampleRate: 48000})
+	c.Assert(s.bitlength(60.0), Equals, -1.0)
+}
+
+func (f *StreamSuite) Test_Bitlength_Forced(c *C) {
+	s := NewStreamReader(nil, Options{Baud: 1200, SampleRate: 44100})
+	c.Assert(s.bitlength(60.0), Equals, 36.75)
+}
+
+func (f *StreamSuite) Test_ScanTransmissionStart_44100(c *C) {
+	s := NewStreamReader(nil, Options{SampleRate: 44100})
+
+	// 1200 baud preamble of alternating bits after some silence
+	stream := make([]int16, 100)
+	stream = append(stream, squarewave(36.75, 100)...)
+
+	start, bitlength := s.ScanTransmissionStart(stream)
+
+	c.Assert(bitlength, Equals, 36.75)
+	c.Assert(start > 100, Equals, true)
+}
+
+func (f *StreamSuite) Test_ScanTransmissionStart_512_48000(c *C) {
+	s := NewStreamReader(nil, Options{SampleRate: 48000})
+
+	// 512 baud, 93.75 samples per bit
+	stream := make([]int16, 100)
+	stream = append(stream, squarewave(93.75, 50)...)
+
+	start, bitlength := s.ScanTransmissionStart(stream)
+
+	c.Assert(bitlength, Equals, 93.75)
+	c.Assert(start > 100, Equals, true)
+}
+
+func (f *StreamSuite) Test_StartScan_EOF(c *C) {
+	s := NewStreamReader(bytes.NewReader([]byte{}), Options{})
+
+	transmissions := make(chan *Transmission, 1)
+	err := s.StartScan(context.Background(), transmissions)
+	c.Assert(err, IsNil)
+
+	_, open := <-transmissions
+	c.Assert(open, Equals, false)
+}
+
+func (f *StreamSuite) Test_StartScan_Flush_At_EOF(c *C) {
+	stream := make([]int16, 100)
+	stream = append(stream, squarewave(40, 1000)...)
+
+	s := NewStreamReader(bytes.NewReader(samplebytes(stream)), Options{SampleRate: 48000})
+
+	transmissions := make(chan *Transmission, 1)
+	scanerr := make(chan error, 1)
+	go func() {
+		scanerr <- s.StartScan(context.Background(), transmissions)
+	}()
+
+	received := []*Transmission{}
+	for t := range transmissions {
+		received = append(received, t)
+	}
+
+	c.Assert(<-scanerr, IsNil)
+	c.Assert(len(received), Equals, 1)
+	c.Assert(received[0].Baud, Equals, 1200)
+	c.Assert(len(received[0].Bits) > 900, Equals, true)
+}
+
+func (f *StreamSuite) Test_StartScan_Cancelled(c *C) {
+	s := NewStreamReader(bytes.NewReader(make([]byte, 100000)), Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	transmissions := make(chan *Transmission, 1)
+	err := s.StartScan(ctx, transmissions)
+	c.Assert(err, Equals, context.Canceled)
+
+	_, open := <-transmissions
+	c.Assert(open, Equals, false)
+}
+
+// samplebytes converts samples to signed 16 bit little endian bytes
+func samplebytes(stream []int16) []byte {
+	b := make([]byte, len(stream)*2)
+	for i, sample := range stream {
+		b[i*2] = byte(uint16(sample))
+		b[i*2+1] = byte(uint16(sample) >> 8)
+	}
+	return b
+}
+
+// squarewave returns a wave of alternating bits with the bitlength specified
+func squarewave(bitlength float64, bits int) []int16 {
+	stream := []int16{}
+	for a := 0; a < int(float64(bits)*bitlength); a += 1 {
+		if int(float64(a)/bitlength)%2 == 0 {
+			stream = append(stream, 1000)
+		} else {
+			stream = append(stream, -1000)
+		}
+	}
+	return stream
+}